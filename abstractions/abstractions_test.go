@@ -0,0 +1,1245 @@
+package abstractions
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/TubarrApp/gocommon/logging/loggingtest"
+	"github.com/TubarrApp/gocommon/sharederrors"
+	"github.com/spf13/cast"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// Config ---------------------------------------------------------------------------------------
+
+// backends returns each Config implementation holding the same file values.
+func backends(t *testing.T, values map[string]any) map[string]Config {
+	t.Helper()
+
+	v := viper.New()
+	if err := v.MergeConfigMap(values); err != nil {
+		t.Fatalf("merge config: %v", err)
+	}
+	return map[string]Config{
+		"viper":  NewViper(v),
+		"memory": NewMemory(values),
+	}
+}
+
+func TestConfigBackends(t *testing.T) {
+	type transcode struct {
+		Codec   string        `mapstructure:"codec"`
+		Retry   time.Duration `mapstructure:"retry"`
+		Workers int           `mapstructure:"workers"`
+	}
+
+	for name, c := range backends(t, map[string]any{
+		"Workers": "4",
+		"ffmpeg": map[string]any{
+			"codec": "h264",
+			"retry": "5s",
+		},
+		"tags": []any{"a", "b"},
+	}) {
+		t.Run(name, func(t *testing.T) {
+			c.SetDefault("workers", 1)
+			c.SetDefault("log-level", "info")
+			c.Set("ffmpeg.codec", "hevc")
+
+			if got := c.GetInt("WORKERS"); got != 4 {
+				t.Errorf("expected file value over default, got %d", got)
+			}
+			if got := c.GetString("log-level"); got != "info" {
+				t.Errorf("expected default, got %q", got)
+			}
+			if got := c.GetString("ffmpeg.codec"); got != "hevc" {
+				t.Errorf("expected override over file value, got %q", got)
+			}
+			if got := c.GetDuration("ffmpeg.retry"); got != 5*time.Second {
+				t.Errorf("expected 5s, got %s", got)
+			}
+			if got := c.GetStringSlice("tags"); !slices.Equal(got, []string{"a", "b"}) {
+				t.Errorf("unexpected slice %v", got)
+			}
+			if !c.IsSet("ffmpeg") || c.IsSet("missing") {
+				t.Errorf("unexpected IsSet results")
+			}
+			if keys := c.AllKeys(); !slices.Contains(keys, "ffmpeg.retry") || !slices.Contains(keys, "log-level") {
+				t.Errorf("unexpected keys %v", keys)
+			}
+
+			// Sub views.
+			sub := c.Sub("ffmpeg")
+			if sub == nil {
+				t.Fatalf("expected ffmpeg sub config")
+			}
+			if got := sub.GetString("codec"); got != "hevc" {
+				t.Errorf("expected sub override, got %q", got)
+			}
+			if c.Sub("workers") != nil {
+				t.Errorf("expected nil sub for scalar key")
+			}
+
+			// Unmarshal.
+			var out struct {
+				Workers int       `mapstructure:"workers"`
+				FFmpeg  transcode `mapstructure:"ffmpeg"`
+			}
+			if err := c.Unmarshal(&out); err != nil {
+				t.Fatalf("unmarshal: %v", err)
+			}
+			if out.Workers != 4 || out.FFmpeg.Codec != "hevc" || out.FFmpeg.Retry != 5*time.Second {
+				t.Errorf("unexpected unmarshal result %+v", out)
+			}
+		})
+	}
+}
+
+func TestMemoryWatch(t *testing.T) {
+	c := NewMemory(map[string]any{"max-cpu": 50})
+
+	var calls int
+	if err := c.Watch(func() { calls++ }); err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+	c.Load(map[string]any{"max-cpu": 75})
+
+	if calls != 1 || c.GetInt("max-cpu") != 75 {
+		t.Errorf("expected one change to 75, got %d calls and %d", calls, c.GetInt("max-cpu"))
+	}
+	if err := NewViper(viper.New()).Watch(func() {}); err == nil {
+		t.Errorf("expected error watching viper without a config file")
+	}
+}
+
+func TestSetDefaultConfig(t *testing.T) {
+	mem := NewMemory(map[string]any{"program": "tubarr"})
+	restore := SetDefaultConfig(mem)
+
+	Set("output", "/tmp")
+	if GetString("program") != "tubarr" || mem.GetString("output") != "/tmp" {
+		t.Errorf("package functions not using the replaced config")
+	}
+
+	restore()
+	if Default() == Config(mem) {
+		t.Errorf("expected previous config restored")
+	}
+}
+
+func TestViperLoadFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "config.json"), `{"workers": 4}`)
+	later := filepath.Join(dir, "later.yaml")
+	writeFile(t, later, "workers: 8\n")
+	loader := FileLoader{Program: "tubarr", SystemDir: filepath.Join(dir, "none"), UserDir: dir}
+
+	// The config type is left unset, so a later YAML file is read as YAML.
+	v := viper.New()
+	if _, err := loader.Load(NewViper(v)); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	v.SetConfigFile(later)
+	if err := v.ReadInConfig(); err != nil || v.GetInt("workers") != 8 {
+		t.Errorf("expected later YAML file read, got %v, %d", err, v.GetInt("workers"))
+	}
+
+	// A type set by the caller is kept.
+	v = viper.New()
+	v.SetConfigType("toml")
+	if _, err := loader.Load(NewViper(v)); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if err := v.ReadConfig(strings.NewReader("workers = 16\n")); err != nil || v.GetInt("workers") != 16 {
+		t.Errorf("expected TOML config type kept, got %v, %d", err, v.GetInt("workers"))
+	}
+}
+
+func TestViperWatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeFile(t, path, "max-cpu: 50\n")
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		t.Fatalf("read config: %v", err)
+	}
+	c := NewViper(v)
+
+	changed := make(chan struct{}, 1)
+	if err := c.Watch(func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}); err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+
+	// Reads while the file is re-read.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for range 200 {
+			_ = c.GetInt("max-cpu")
+		}
+	}()
+	writeFile(t, path, "max-cpu: 75\n")
+	<-done
+
+	// The file may be seen half written first, wait for the final value.
+	deadline := time.After(5 * time.Second)
+	for c.GetInt("max-cpu") != 75 {
+		select {
+		case <-changed:
+		case <-deadline:
+			t.Fatalf("expected re-read value 75, got %d", c.GetInt("max-cpu"))
+		}
+	}
+
+	// No re-reads after Close.
+	if err := c.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	for len(changed) > 0 {
+		<-changed
+	}
+	writeFile(t, path, "max-cpu: 90\n")
+	time.Sleep(300 * time.Millisecond)
+	if got := c.GetInt("max-cpu"); got != 75 || len(changed) != 0 {
+		t.Errorf("expected no re-read after close, got %d", got)
+	}
+
+	// Files loaded by a FileLoader are watched through a Reloader.
+	dir := t.TempDir()
+	path = filepath.Join(dir, "config.yaml")
+	writeFile(t, path, "max-cpu: 50\n")
+
+	loader := FileLoader{Program: "tubarr", SystemDir: filepath.Join(dir, "none"), UserDir: dir}
+	c = NewViper(viper.New())
+	if _, err := loader.Load(c); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if err := c.Watch(func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}); err != nil {
+		t.Fatalf("watch loaded files: %v", err)
+	}
+
+	tl := loggingtest.NewTestLogger(t)
+	r, err := NewReloader(c, loader, nil, tl.ProgramLogger)
+	if err != nil {
+		t.Fatalf("new reloader: %v", err)
+	}
+	defer r.Close()
+	for len(changed) > 0 {
+		<-changed
+	}
+
+	writeFile(t, path, "max-cpu: 75\n")
+	if err := r.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("expected onChange after reload")
+	}
+	if got := c.GetInt("max-cpu"); got != 75 {
+		t.Errorf("expected reloaded value 75, got %d", got)
+	}
+}
+
+// Typed getters ----------------------------------------------------------------------------------
+
+func TestTypedGetters(t *testing.T) {
+	type channel struct {
+		Output string `mapstructure:"output"`
+		Codec  string `mapstructure:"codec"`
+	}
+
+	for name, c := range backends(t, map[string]any{
+		"retry":      "1m30s",
+		"started":    "2026-01-02T03:04:05Z",
+		"min-free":   "2GB",
+		"max-size":   4096,
+		"ports":      []any{8080, "8081"},
+		"headers":    map[string]any{"User-Agent": "tubarr"},
+		"channels":   map[string]any{"news": map[string]any{"output": "/media/news", "codec": "hevc"}},
+		"bad-retry":  "soon",
+		"bad-size":   "2XB",
+		"bad-ports":  []any{"http"},
+		"bad-time":   "yesterday",
+		"bad-scalar": "x",
+		"bad-unit":   30,
+	}) {
+		t.Run(name, func(t *testing.T) {
+			if d, err := c.GetDurationE("retry"); err != nil || d != 90*time.Second {
+				t.Errorf("GetDurationE = %s, %v", d, err)
+			}
+			if ts, err := c.GetTimeE("started"); err != nil || !ts.Equal(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)) {
+				t.Errorf("GetTimeE = %s, %v", ts, err)
+			}
+			if n, err := c.GetSizeInBytesE("min-free"); err != nil || n != 2<<30 {
+				t.Errorf("GetSizeInBytesE = %d, %v", n, err)
+			}
+			if n, err := c.GetSizeInBytesE("max-size"); err != nil || n != 4096 {
+				t.Errorf("GetSizeInBytesE plain = %d, %v", n, err)
+			}
+			if ports, err := c.GetIntSliceE("ports"); err != nil || !slices.Equal(ports, []int{8080, 8081}) {
+				t.Errorf("GetIntSliceE = %v, %v", ports, err)
+			}
+			if m, err := c.GetStringMapStringE("headers"); err != nil || m["user-agent"] != "tubarr" {
+				t.Errorf("GetStringMapStringE = %v, %v", m, err)
+			}
+			if m, err := c.GetStringMapE("channels"); err != nil || len(m) != 1 {
+				t.Errorf("GetStringMapE = %v, %v", m, err)
+			}
+
+			var ch channel
+			if err := c.UnmarshalKey("channels.news", &ch); err != nil || ch.Output != "/media/news" || ch.Codec != "hevc" {
+				t.Errorf("UnmarshalKey = %+v, %v", ch, err)
+			}
+
+			// Unset keys are reported apart from malformed values.
+			if d, err := c.GetDurationE("missing"); !errors.Is(err, ErrNotSet) || d != 0 {
+				t.Errorf("expected ErrNotSet for unset key, got %s, %v", d, err)
+			}
+
+			// Malformed values.
+			var keyErr *KeyError
+			if _, err := c.GetDurationE("bad-retry"); !errors.As(err, &keyErr) || keyErr.Key != "bad-retry" {
+				t.Errorf("expected KeyError for bad duration, got %v", err)
+			}
+			if _, err := c.GetSizeInBytesE("bad-size"); !errors.Is(err, sharederrors.ErrInvalidSize) {
+				t.Errorf("expected ErrInvalidSize, got %v", err)
+			}
+			if _, err := c.GetIntSliceE("bad-ports"); !errors.Is(err, ErrParse) {
+				t.Errorf("expected ErrParse for bad int slice, got %v", err)
+			}
+			if _, err := c.GetTimeE("bad-time"); err == nil {
+				t.Errorf("expected error for bad time")
+			}
+			if _, err := c.GetStringMapE("bad-scalar"); err == nil {
+				t.Errorf("expected error for scalar map")
+			}
+			if d, err := c.GetDurationE("bad-unit"); !errors.Is(err, ErrWrongType) {
+				t.Errorf("expected ErrWrongType for duration without a unit, got %s, %v", d, err)
+			}
+		})
+	}
+}
+
+func TestStrictGetters(t *testing.T) {
+	for name, c := range backends(t, map[string]any{
+		"workers":  "4",
+		"ffmpeg":   map[string]any{"codec": "h264"},
+		"retries":  "many",
+		"tags":     []any{"a", "b"},
+		"retry":    "soon",
+		"started":  "yesterday",
+		"ports":    []any{"http"},
+		"min-free": "2XB",
+		"headers":  "x",
+		"opts":     []any{"a"},
+	}) {
+		t.Run(name, func(t *testing.T) {
+			c.SetDefault("verbose", true)
+			c.Set("max-cpu", 80.5)
+
+			if n, err := c.GetIntE("workers"); err != nil || n != 4 {
+				t.Errorf("GetIntE = %d, %v", n, err)
+			}
+			if b, err := c.GetBoolE("verbose"); err != nil || !b {
+				t.Errorf("GetBoolE = %v, %v", b, err)
+			}
+			if f, err := c.GetFloat64E("max-cpu"); err != nil || f != 80.5 {
+				t.Errorf("GetFloat64E = %v, %v", f, err)
+			}
+			if tags, err := c.GetStringSliceE("tags"); err != nil || !slices.Equal(tags, []string{"a", "b"}) {
+				t.Errorf("GetStringSliceE = %v, %v", tags, err)
+			}
+
+			var keyErr *KeyError
+			if _, err := c.GetStringE("missing"); !errors.Is(err, ErrNotSet) || sharederrors.KindOf(err) != sharederrors.KindNotFound {
+				t.Errorf("expected ErrNotSet, got %v", err)
+			}
+			if _, err := c.GetIntE("ffmpeg"); !errors.Is(err, ErrWrongType) {
+				t.Errorf("expected ErrWrongType for map, got %v", err)
+			}
+			if _, err := c.GetUint64E("retries"); !errors.Is(err, ErrParse) || !errors.As(err, &keyErr) || keyErr.Source != SourceFile {
+				t.Errorf("expected ErrParse from file, got %v", err)
+			}
+
+			// Every error-returning getter reports the key, its source and the kind of problem.
+			c.Set("timeout", map[string]any{"s": 1})
+			for _, tc := range []struct {
+				name string
+				get  func() error
+				want error
+				src  Source
+			}{
+				{"GetDurationE unset", func() error { _, err := c.GetDurationE("missing"); return err }, ErrNotSet, SourceNone},
+				{"GetTimeE unset", func() error { _, err := c.GetTimeE("missing"); return err }, ErrNotSet, SourceNone},
+				{"GetStringMapE unset", func() error { _, err := c.GetStringMapE("missing"); return err }, ErrNotSet, SourceNone},
+				{"GetStringMapStringE unset", func() error { _, err := c.GetStringMapStringE("missing"); return err }, ErrNotSet, SourceNone},
+				{"GetIntSliceE unset", func() error { _, err := c.GetIntSliceE("missing"); return err }, ErrNotSet, SourceNone},
+				{"GetSizeInBytesE unset", func() error { _, err := c.GetSizeInBytesE("missing"); return err }, ErrNotSet, SourceNone},
+				{"GetDurationE parse", func() error { _, err := c.GetDurationE("retry"); return err }, ErrParse, SourceFile},
+				{"GetDurationE wrong type", func() error { _, err := c.GetDurationE("timeout"); return err }, ErrWrongType, SourceOverride},
+				{"GetTimeE parse", func() error { _, err := c.GetTimeE("started"); return err }, ErrParse, SourceFile},
+				{"GetStringMapE wrong type", func() error { _, err := c.GetStringMapE("headers"); return err }, ErrWrongType, SourceFile},
+				{"GetStringMapStringE wrong type", func() error { _, err := c.GetStringMapStringE("tags"); return err }, ErrWrongType, SourceFile},
+				{"GetIntSliceE parse", func() error { _, err := c.GetIntSliceE("ports"); return err }, ErrParse, SourceFile},
+				{"GetSizeInBytesE parse", func() error { _, err := c.GetSizeInBytesE("min-free"); return err }, ErrParse, SourceFile},
+				{"GetSizeInBytesE wrong type", func() error { _, err := c.GetSizeInBytesE("ffmpeg"); return err }, ErrWrongType, SourceFile},
+				{"UnmarshalKey wrong type", func() error { var n int; return c.UnmarshalKey("opts", &n) }, ErrWrongType, SourceFile},
+			} {
+				err := tc.get()
+				if !errors.Is(err, tc.want) || !errors.As(err, &keyErr) || keyErr.Source != tc.src {
+					t.Errorf("%s: expected %v from %q, got %v", tc.name, tc.want, tc.src, err)
+				}
+			}
+
+			for key, want := range map[string]Source{
+				"workers":      SourceFile,
+				"ffmpeg.codec": SourceFile,
+				"verbose":      SourceDefault,
+				"max-cpu":      SourceOverride,
+				"missing":      SourceNone,
+			} {
+				if got := c.Source(key); got != want {
+					t.Errorf("Source(%q) = %q, expected %q", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestStrictConversion(t *testing.T) {
+	for _, tc := range []struct {
+		value any
+		want  int
+		err   error
+	}{
+		{true, 0, ErrWrongType},
+		{"010", 10, nil},
+		{"1.5", 0, ErrParse},
+		{3.7, 0, ErrWrongType},
+		{4.0, 4, nil},
+		{" 42 ", 42, nil},
+		{int64(-7), -7, nil},
+		{"0x10", 0, ErrParse},
+		{[]any{1}, 0, ErrWrongType},
+	} {
+		c := NewMemory(map[string]any{"n": tc.value})
+
+		n, err := c.GetIntE("n")
+		if !errors.Is(err, tc.err) || n != tc.want {
+			t.Errorf("GetIntE(%#v) = %d, %v, expected %d, %v", tc.value, n, err, tc.want, tc.err)
+		}
+
+		s, err := NewSchema(Key{Name: "n", Type: TypeInt})
+		if err != nil {
+			t.Fatalf("new schema: %v", err)
+		}
+		err = s.Load(c)
+		if !errors.Is(err, tc.err) {
+			t.Errorf("schema TypeInt for %#v: expected %v, got %v", tc.value, tc.err, err)
+		}
+	}
+
+	for _, tc := range []struct {
+		get  func(Config) error
+		err  error
+		name string
+	}{
+		{func(c Config) error { _, err := c.GetBoolE("one"); return err }, ErrWrongType, "GetBoolE number"},
+		{func(c Config) error { _, err := c.GetBoolE("word"); return err }, ErrParse, "GetBoolE word"},
+		{func(c Config) error { _, err := c.GetUint64E("negative"); return err }, ErrParse, "GetUint64E negative"},
+		{func(c Config) error { _, err := c.GetUint64E("fraction"); return err }, ErrWrongType, "GetUint64E fraction"},
+		{func(c Config) error { _, err := c.GetFloat64E("flag"); return err }, ErrWrongType, "GetFloat64E bool"},
+		{func(c Config) error { _, err := c.GetFloat64E("word"); return err }, ErrParse, "GetFloat64E word"},
+		{func(c Config) error { _, err := c.GetSizeInBytesE("fraction"); return err }, ErrWrongType, "GetSizeInBytesE fraction"},
+		{func(c Config) error { _, err := c.GetIntSliceE("octal"); return err }, nil, "GetIntSliceE decimal strings"},
+	} {
+		c := NewMemory(map[string]any{
+			"one":      1,
+			"word":     "maybe",
+			"negative": -1,
+			"fraction": 1.5,
+			"flag":     true,
+			"octal":    []any{"010", 8},
+		})
+		if err := tc.get(c); !errors.Is(err, tc.err) {
+			t.Errorf("%s: expected %v, got %v", tc.name, tc.err, err)
+		}
+	}
+	if ns, _ := NewMemory(map[string]any{"ns": []any{"010", 8}}).GetIntSliceE("ns"); !slices.Equal(ns, []int{10, 8}) {
+		t.Errorf("expected base 10 elements, got %v", ns)
+	}
+}
+
+func TestViperFlagSource(t *testing.T) {
+	flags := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	flags.Int("workers", 1, "")
+	flags.String("codec", "h264", "")
+	if err := flags.Parse([]string{"--workers", "8"}); err != nil {
+		t.Fatalf("parse flags: %v", err)
+	}
+
+	c := NewViper(viper.New())
+	for _, name := range []string{"workers", "codec"} {
+		if err := c.BindFlag(name, flags.Lookup(name)); err != nil {
+			t.Fatalf("bind flag: %v", err)
+		}
+	}
+	c.Viper().Set("direct", "x")
+
+	if n, err := c.GetIntE("workers"); err != nil || n != 8 || c.Source("workers") != SourceFlag {
+		t.Errorf("expected 8 from flag, got %d, %v from %q", n, err, c.Source("workers"))
+	}
+	if got := c.Source("codec"); got != SourceDefault {
+		t.Errorf("expected unchanged flag to be a default, got %q", got)
+	}
+	if got := c.Source("direct"); got != SourceUnknown {
+		t.Errorf("expected unknown source for value set on viper directly, got %q", got)
+	}
+}
+
+// Environment ----------------------------------------------------------------------------------
+
+func TestEnvBinding(t *testing.T) {
+	tubarr := EnvBinding{Prefix: "TUBARR", Keys: []string{"ffmpeg.hw-accel", "workers", "max-cpu"}}
+	metarr := EnvBinding{Prefix: "METARR_", Keys: tubarr.Keys}
+
+	if got := tubarr.EnvVar("ffmpeg.hw-accel"); got != "TUBARR_FFMPEG_HW_ACCEL" {
+		t.Errorf("unexpected variable name %q", got)
+	}
+	if got := metarr.EnvVars()["workers"]; got != "METARR_WORKERS" {
+		t.Errorf("unexpected variable name %q", got)
+	}
+
+	t.Setenv("TUBARR_FFMPEG_HW_ACCEL", "nvidia")
+	t.Setenv("TUBARR_WORKERS", "8")
+	t.Setenv("TUBARR_MAX_CPU", "")
+	t.Setenv("TUBARR_LOG_LEVEL", "debug")
+	t.Setenv("METARR_WORKERS", "2")
+
+	for name, c := range backends(t, map[string]any{
+		"workers":   4,
+		"max-cpu":   50,
+		"log-level": "info",
+		"ffmpeg":    map[string]any{"hw-accel": "auto"},
+	}) {
+		t.Run(name, func(t *testing.T) {
+			if err := tubarr.Bind(c); err != nil {
+				t.Fatalf("bind: %v", err)
+			}
+
+			if got := c.GetString("ffmpeg.hw-accel"); got != "nvidia" || c.Source("ffmpeg.hw-accel") != SourceEnv {
+				t.Errorf("expected nested key from env, got %q from %q", got, c.Source("ffmpeg.hw-accel"))
+			}
+			if n, err := c.GetIntE("workers"); err != nil || n != 8 {
+				t.Errorf("expected workers 8 from env, got %d, %v", n, err)
+			}
+			if got := c.GetInt("max-cpu"); got != 50 || c.Source("max-cpu") != SourceFile {
+				t.Errorf("expected empty variable ignored, got %d from %q", got, c.Source("max-cpu"))
+			}
+			if got := c.GetString("log-level"); got != "info" {
+				t.Errorf("expected unbound key to ignore env, got %q", got)
+			}
+
+			c.Set("workers", 1)
+			if got := c.GetInt("workers"); got != 1 || c.Source("workers") != SourceOverride {
+				t.Errorf("expected override over env, got %d", got)
+			}
+		})
+	}
+
+	if err := (EnvBinding{Prefix: "TUBARR", Keys: []string{""}}).Bind(NewMemory(nil)); err == nil {
+		t.Errorf("expected error binding an empty key")
+	}
+}
+
+// Files ----------------------------------------------------------------------------------------
+
+// writeFile writes a test config file.
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("create dir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+}
+
+func TestFileLoader(t *testing.T) {
+	root := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", filepath.Join(root, "xdg"))
+
+	system := filepath.Join(root, "etc", "tubarr", "config.yaml")
+	user := filepath.Join(root, "xdg", "tubarr", "config.toml")
+	run := filepath.Join(root, "run.json")
+	writeFile(t, system, "workers: 2\nffmpeg:\n  codec: h264\n  preset: slow\nlog-level: info\n")
+	writeFile(t, user, "workers = 4\n[ffmpeg]\ncodec = \"hevc\"\n")
+	writeFile(t, run, `{"log-level": "debug"}`)
+	writeFile(t, filepath.Join(root, "xdg", "tubarr", "config.json"), `{"ignored": true}`)
+
+	loader := FileLoader{Program: "tubarr", SystemDir: filepath.Dir(system), Path: run}
+	for name, c := range backends(t, map[string]any{"stale": 1}) {
+		t.Run(name, func(t *testing.T) {
+			files, err := loader.Load(c)
+			if err != nil {
+				t.Fatalf("load: %v", err)
+			}
+
+			layers := files.Files()
+			if len(layers) != 3 || layers[0].Layer != LayerSystem || layers[1].Path != user || layers[2].Layer != LayerRun {
+				t.Fatalf("unexpected files %+v", layers)
+			}
+
+			for key, want := range map[string]any{
+				"workers":       4,
+				"ffmpeg.codec":  "hevc",
+				"ffmpeg.preset": "slow",
+				"log-level":     "debug",
+			} {
+				if got := c.GetString(key); got != cast.ToString(want) {
+					t.Errorf("%s = %q, expected %v", key, got, want)
+				}
+			}
+			if c.IsSet("stale") || c.IsSet("ignored") {
+				t.Errorf("expected previous and lower priority extension values to be absent")
+			}
+			if c.Source("ffmpeg.preset") != SourceFile {
+				t.Errorf("expected file source, got %q", c.Source("ffmpeg.preset"))
+			}
+
+			for key, want := range map[string]string{
+				"workers":       user,
+				"ffmpeg.preset": system,
+				"ffmpeg":        user,
+				"log-level":     run,
+				"missing":       "",
+			} {
+				if got := files.FileOf(key); got != want {
+					t.Errorf("FileOf(%q) = %q, expected %q", key, got, want)
+				}
+			}
+		})
+	}
+
+	// Errors.
+	if _, err := (FileLoader{Program: "tubarr", Path: filepath.Join(root, "missing.yaml")}).Find(); !errors.Is(err, sharederrors.ErrPathNotFound) {
+		t.Errorf("expected ErrPathNotFound for missing per-run file, got %v", err)
+	}
+	bad := filepath.Join(root, "bad.yaml")
+	writeFile(t, bad, "workers: [\n")
+	if _, err := (FileLoader{Program: "tubarr", SystemDir: root, Path: bad}).Load(NewMemory(nil)); err == nil {
+		t.Errorf("expected parse error")
+	}
+}
+
+func TestUserConfigDir(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", "/xdg")
+	if dir, err := UserConfigDir("metarr"); err != nil || dir != "/xdg/metarr" {
+		t.Errorf("UserConfigDir = %q, %v", dir, err)
+	}
+
+	t.Setenv("XDG_CONFIG_HOME", "")
+	t.Setenv("HOME", "/home/user")
+	if dir, err := UserConfigDir("metarr"); err != nil || dir != "/home/user/.config/metarr" {
+		t.Errorf("UserConfigDir without XDG = %q, %v", dir, err)
+	}
+}
+
+// Reload ---------------------------------------------------------------------------------------
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	writeFile(t, path, "max-cpu: 50\nffmpeg:\n  video-codec: h264\n")
+
+	tl := loggingtest.NewTestLogger(t)
+	c := NewMemory(nil)
+	r, err := NewReloader(c, FileLoader{Program: "tubarr", SystemDir: filepath.Join(dir, "none"), UserDir: dir}, testSchema(t), tl.ProgramLogger)
+	if err != nil {
+		t.Fatalf("new reloader: %v", err)
+	}
+	defer r.Close()
+
+	type change struct{ old, new any }
+	cpu := make(chan change, 4)
+	ffmpeg := make(chan change, 4)
+	r.OnChange("max-cpu", func(old, new any) { cpu <- change{old, new} })
+	r.OnChange("ffmpeg", func(old, new any) { ffmpeg <- change{old, new} })
+
+	// Valid edit, normalized by the schema.
+	writeFile(t, path, "max-cpu: 75\nffmpeg:\n  video-codec: HEVC\n")
+	if err := r.Reload(); err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if got := <-cpu; cast.ToFloat64(got.old) != 50 || cast.ToFloat64(got.new) != 75 {
+		t.Errorf("unexpected max-cpu change %+v", got)
+	}
+	if got := <-ffmpeg; cast.ToStringMapString(got.new)["video-codec"] != "hevc" {
+		t.Errorf("unexpected ffmpeg change %+v", got)
+	}
+	if got := c.Source("ffmpeg.video-codec"); got != SourceFile {
+		t.Errorf("expected normalized file value to keep its source, got %q", got)
+	}
+	tl.AssertLogged(t, loggingtest.LevelInfo, `"max-cpu" changed: 50 -> 75`)
+
+	// Invalid edit, previous values kept.
+	writeFile(t, path, "max-cpu: 90\nffmpeg:\n  video-codec: divx\n")
+	if err := r.Reload(); !errors.Is(err, sharederrors.ErrInvalidCodec) {
+		t.Fatalf("expected codec error, got %v", err)
+	}
+	if c.GetFloat64("max-cpu") != 75 || c.GetString("ffmpeg.video-codec") != "hevc" || len(cpu) != 0 {
+		t.Errorf("expected previous values kept, got %v and %q", c.GetFloat64("max-cpu"), c.GetString("ffmpeg.video-codec"))
+	}
+	tl.AssertLogged(t, loggingtest.LevelError, "keeping previous values")
+
+	// File events.
+	writeFile(t, path, "max-cpu: 25\nffmpeg:\n  video-codec: hevc\n")
+	select {
+	case got := <-cpu:
+		if cast.ToFloat64(got.new) != 25 {
+			t.Errorf("unexpected max-cpu change %+v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no reload after file edit")
+	}
+	if len(ffmpeg) != 0 {
+		t.Errorf("expected no ffmpeg change notification")
+	}
+	if r.Files().FileOf("max-cpu") != path {
+		t.Errorf("expected loaded files updated")
+	}
+}
+
+func TestReloaderMissingDir(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "home", "tubarr")
+
+	c := NewMemory(nil)
+	r, err := NewReloader(c, FileLoader{Program: "tubarr", SystemDir: filepath.Join(dir, "none"), UserDir: dir}, testSchema(t), nil)
+	if err != nil {
+		t.Fatalf("new reloader: %v", err)
+	}
+	cpu := make(chan any, 4)
+	r.OnChange("max-cpu", func(_, new any) { cpu <- new })
+
+	// Directory created after the reloader, with no logger.
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatalf("create dir: %v", err)
+	}
+	writeFile(t, filepath.Join(dir, "config.yaml"), "max-cpu: 50\n")
+	select {
+	case got := <-cpu:
+		if cast.ToFloat64(got) != 50 {
+			t.Errorf("unexpected max-cpu %v", got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no reload after creating the config directory")
+	}
+
+	// No reload after Close, even if one was scheduled.
+	r.schedule()
+	if err := r.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	r.schedule()
+	writeFile(t, filepath.Join(dir, "config.yaml"), "max-cpu: 75\n")
+	time.Sleep(2 * ReloadDelay)
+	if c.GetFloat64("max-cpu") != 50 || len(cpu) != 0 {
+		t.Errorf("expected no reload after close, got %v", c.GetFloat64("max-cpu"))
+	}
+}
+
+// Dump -----------------------------------------------------------------------------------------
+
+func TestDump(t *testing.T) {
+	t.Setenv("TUBARR_WORKERS", "8")
+
+	schema, err := NewSchema(
+		Key{Name: "workers", Type: TypeInt},
+		Key{Name: "log-level", Type: TypeString, Default: "info"},
+		Key{Name: "output", Type: TypeString},
+		Key{Name: "indexer.key", Type: TypeString, Secret: true},
+	)
+	if err != nil {
+		t.Fatalf("new schema: %v", err)
+	}
+
+	for name, c := range backends(t, map[string]any{
+		"workers": 4,
+		"indexer": map[string]any{"key": "abc123", "url": "https://example.com"},
+		"auth":    map[string]any{"password": "hunter2"},
+	}) {
+		t.Run(name, func(t *testing.T) {
+			if err := (EnvBinding{Prefix: "TUBARR", Keys: []string{"workers"}}).Bind(c); err != nil {
+				t.Fatalf("bind env: %v", err)
+			}
+			if err := schema.Load(c); err != nil {
+				t.Fatalf("load schema: %v", err)
+			}
+			c.Set("max-cpu", 80)
+
+			settings := Dump(c, DumpOptions{Schema: schema, Secrets: []string{"indexer.url"}})
+			byKey := make(map[string]Setting)
+			for _, s := range settings {
+				byKey[s.Key] = s
+			}
+
+			for key, want := range map[string]Setting{
+				"workers":       {Key: "workers", Value: "8", Source: SourceEnv, Set: true},
+				"log-level":     {Key: "log-level", Value: "info", Source: SourceDefault},
+				"max-cpu":       {Key: "max-cpu", Value: 80, Source: SourceOverride, Set: true},
+				"output":        {Key: "output"},
+				"indexer.key":   {Key: "indexer.key", Value: MaskedValue, Source: SourceFile, Set: true, Secret: true},
+				"indexer.url":   {Key: "indexer.url", Value: MaskedValue, Source: SourceFile, Set: true, Secret: true},
+				"auth.password": {Key: "auth.password", Value: MaskedValue, Source: SourceFile, Set: true, Secret: true},
+			} {
+				got := byKey[key]
+				if cast.ToString(got.Value) != cast.ToString(want.Value) || got.Source != want.Source || got.Set != want.Set || got.Secret != want.Secret {
+					t.Errorf("%s = %+v, expected %+v", key, got, want)
+				}
+			}
+			if !slices.IsSortedFunc(settings, func(a, b Setting) int { return strings.Compare(a.Key, b.Key) }) {
+				t.Errorf("expected settings sorted by key")
+			}
+
+			for _, format := range []string{DumpFormatYAML, DumpFormatJSON, DumpFormatTable} {
+				var b strings.Builder
+				if err := WriteDump(&b, settings, format); err != nil {
+					t.Fatalf("write %s: %v", format, err)
+				}
+				if out := b.String(); strings.Contains(out, "hunter2") || strings.Contains(out, "abc123") || !strings.Contains(out, "log-level") {
+					t.Errorf("unexpected %s output:\n%s", format, out)
+				}
+			}
+		})
+	}
+
+	if err := WriteDump(io.Discard, nil, "xml"); err == nil {
+		t.Errorf("expected error for unknown format")
+	}
+}
+
+func TestDumpFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	writeFile(t, path, "workers: 4\n")
+
+	c := NewMemory(nil)
+	files, err := FileLoader{Program: "tubarr", SystemDir: filepath.Join(dir, "none"), UserDir: dir}.Load(c)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	var b strings.Builder
+	if err := WriteDump(&b, Dump(c, DumpOptions{Files: files}), DumpFormatTable); err != nil {
+		t.Fatalf("write table: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[0], "KEY") || !strings.HasSuffix(lines[0], "FILE") || !strings.HasSuffix(lines[1], path) {
+		t.Errorf("unexpected table:\n%s", b.String())
+	}
+}
+
+// Scope ----------------------------------------------------------------------------------------
+
+func TestScope(t *testing.T) {
+	type transcode struct {
+		Codec  string `mapstructure:"codec"`
+		Preset string `mapstructure:"preset"`
+	}
+
+	for name, c := range backends(t, map[string]any{
+		"output": "/media",
+		"ffmpeg": map[string]any{"codec": "h264", "preset": "slow"},
+		"channels": map[string]any{
+			"news": map[string]any{
+				"output": "/media/news",
+				"ffmpeg": map[string]any{"codec": "HEVC"},
+			},
+			"sports": map[string]any{"output": "/media/sports", "quality": "1080p"},
+		},
+	}) {
+		t.Run(name, func(t *testing.T) {
+			news := NewScope(c, "Channels.News")
+			other := NewScope(c, "channels.other")
+
+			// Sibling scopes are not part of the view.
+			keys := news.AllKeys()
+			slices.Sort(keys)
+			if want := []string{"ffmpeg.codec", "ffmpeg.preset", "output"}; !slices.Equal(keys, want) {
+				t.Errorf("expected keys %v, got %v", want, keys)
+			}
+			var all map[string]any
+			if err := news.Unmarshal(&all); err != nil || all["output"] != "/media/news" || all["quality"] != nil || all["channels"] != nil {
+				t.Errorf("Unmarshal = %v, %v", all, err)
+			}
+
+			if got := news.GetString("output"); got != "/media/news" {
+				t.Errorf("expected scoped output, got %q", got)
+			}
+			if got := other.GetString("output"); got != "/media" {
+				t.Errorf("expected global fallback, got %q", got)
+			}
+			if got := news.GetString("ffmpeg.preset"); got != "slow" {
+				t.Errorf("expected nested global fallback, got %q", got)
+			}
+
+			if r, ok := news.Resolve("output"); !ok || !r.Scoped || r.Key != "channels.news.output" || r.Source != SourceFile {
+				t.Errorf("unexpected scoped resolution %+v", r)
+			}
+			if r, ok := other.Resolve("output"); !ok || r.Scoped || r.Key != "output" {
+				t.Errorf("unexpected global resolution %+v", r)
+			}
+			if _, ok := news.Resolve("missing"); ok || news.IsSet("missing") {
+				t.Errorf("expected unset key")
+			}
+
+			// Maps merge, scoped keys first.
+			var tc transcode
+			if err := news.UnmarshalKey("ffmpeg", &tc); err != nil || tc.Codec != "HEVC" || tc.Preset != "slow" {
+				t.Errorf("UnmarshalKey = %+v, %v", tc, err)
+			}
+			sub := news.Sub("ffmpeg")
+			if sub == nil || sub.GetString("codec") != "HEVC" || sub.GetString("preset") != "slow" {
+				t.Errorf("unexpected merged sub view")
+			}
+
+			// Schemas validate the resolved values.
+			schema, err := NewSchema(Key{Name: "ffmpeg.codec", Type: TypeString, Validate: ValidVideoCodec})
+			if err != nil {
+				t.Fatalf("new schema: %v", err)
+			}
+			if err := schema.Load(news); err != nil {
+				t.Fatalf("load schema: %v", err)
+			}
+			if got := news.GetString("ffmpeg.codec"); got != "hevc" || c.GetString("ffmpeg.codec") != "h264" {
+				t.Errorf("expected scoped value normalized, got %q and global %q", got, c.GetString("ffmpeg.codec"))
+			}
+
+			// Set writes the scoped key.
+			other.Set("output", "/media/other")
+			if c.GetString("channels.other.output") != "/media/other" || c.GetString("output") != "/media" {
+				t.Errorf("expected Set to write the scoped key only")
+			}
+		})
+	}
+}
+
+func TestScopeConcurrent(t *testing.T) {
+	values := map[string]any{"output": "/media", "concurrency": 2}
+	for name, c := range map[string]Config{
+		"viper default": NewViper(nil),
+		"memory":        NewMemory(values),
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Cleanup(SetDefaultConfig(c))
+			t.Cleanup(viper.Reset)
+			for k, v := range values {
+				c.Set(k, v)
+			}
+
+			var wg sync.WaitGroup
+			for i := range 8 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+
+					s := Scope(fmt.Sprintf("channels.c%d", i))
+					for j := range 100 {
+						s.Set("concurrency", j)
+						if got := s.GetInt("concurrency"); got != j {
+							t.Errorf("scope %d: expected %d, got %d", i, j, got)
+							return
+						}
+						if s.GetString("output") != "/media" || !s.IsSet("output") {
+							t.Errorf("scope %d: expected global output", i)
+							return
+						}
+						_ = s.AllKeys()
+					}
+				}()
+			}
+			wg.Wait()
+		})
+	}
+}
+
+// Concurrency ----------------------------------------------------------------------------------
+
+func TestSnapshot(t *testing.T) {
+	for name, c := range backends(t, map[string]any{
+		"ffmpeg": map[string]any{"codec": "h264"},
+		"tags":   []any{"a", "b"},
+	}) {
+		t.Run(name, func(t *testing.T) {
+			c.SetDefault("workers", 1)
+			c.Set("max-cpu", 50)
+
+			snap := NewSnapshot(c)
+			c.Set("max-cpu", 90)
+			c.Set("ffmpeg.codec", "hevc")
+			c.Set("tags", []string{"c"})
+
+			if snap.GetInt("max-cpu") != 50 || snap.GetString("ffmpeg.codec") != "h264" || !slices.Equal(snap.GetStringSlice("tags"), []string{"a", "b"}) {
+				t.Errorf("expected snapshot unchanged by later Set calls")
+			}
+			for key, want := range map[string]Source{
+				"max-cpu":      SourceOverride,
+				"ffmpeg.codec": SourceFile,
+				"ffmpeg":       SourceFile,
+				"workers":      SourceDefault,
+				"missing":      SourceNone,
+			} {
+				if got := snap.Source(key); got != want {
+					t.Errorf("Source(%q) = %q, expected %q", key, got, want)
+				}
+			}
+			if sub := snap.Sub("ffmpeg"); sub == nil || sub.GetString("codec") != "h264" || sub.Source("codec") != SourceFile {
+				t.Errorf("unexpected snapshot sub view")
+			}
+			if snap.Watch(func() {}) == nil {
+				t.Errorf("expected error watching a snapshot")
+			}
+
+			// Scoped snapshots resolve the fallback when taken.
+			c.Set("channels.news.max-cpu", 10)
+			scoped := NewSnapshot(NewScope(c, "channels.news"))
+			c.Set("channels.news.max-cpu", 20)
+			if scoped.GetInt("max-cpu") != 10 || scoped.GetString("ffmpeg.codec") != "hevc" {
+				t.Errorf("unexpected scoped snapshot values %v, %v", scoped.GetInt("max-cpu"), scoped.GetString("ffmpeg.codec"))
+			}
+		})
+	}
+
+	// Set and SetDefault change only the snapshot.
+	c := NewMemory(map[string]any{"workers": 4})
+	snap := NewSnapshot(c)
+	snap.Set("workers", 2)
+	snap.SetDefault("retries", 3)
+	copied := NewSnapshot(snap)
+	snap.Set("workers", 1)
+	for _, check := range []struct {
+		cfg  Config
+		key  string
+		want int
+		src  Source
+	}{
+		{snap, "workers", 1, SourceOverride},
+		{snap, "retries", 3, SourceDefault},
+		{copied, "workers", 2, SourceOverride},
+		{c, "workers", 4, SourceFile},
+		{c, "retries", 0, SourceNone},
+	} {
+		if got := check.cfg.GetInt(check.key); got != check.want || check.cfg.Source(check.key) != check.src {
+			t.Errorf("%T %q = %d from %q, expected %d from %q", check.cfg, check.key, got, check.cfg.Source(check.key), check.want, check.src)
+		}
+	}
+}
+
+// TestConcurrentAccess is meant for the race detector (go test -race).
+func TestConcurrentAccess(t *testing.T) {
+	v := viper.New()
+	if err := v.MergeConfigMap(map[string]any{"output": "/media"}); err != nil {
+		t.Fatalf("merge config: %v", err)
+	}
+	defer SetDefaultConfig(NewViper(v))()
+
+	schema, err := NewSchema(Key{Name: "concurrency", Type: TypeInt, Default: 1, Validate: ValidConcurrencyLimit})
+	if err != nil {
+		t.Fatalf("new schema: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := range 4 {
+		wg.Add(3)
+
+		// Writers.
+		go func() {
+			defer wg.Done()
+			for j := range 50 {
+				Set("concurrency", j)
+				SetDefault(fmt.Sprintf("key-%d", i), j)
+				if err := LoadSchema(schema); err != nil {
+					t.Errorf("load schema: %v", err)
+					return
+				}
+			}
+		}()
+
+		// Readers.
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				_ = GetString("output")
+				_, _ = GetIntE("concurrency")
+				_ = IsSet("concurrency")
+				_ = SourceOf("output")
+				_ = AllKeys()
+				_ = Scope("channels.news").GetString("output")
+			}
+		}()
+
+		// Jobs.
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				snap := Snapshot()
+				if snap.GetString("output") != "/media" || snap.GetInt("concurrency") != snap.GetInt("concurrency") {
+					t.Errorf("inconsistent snapshot")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Schema ---------------------------------------------------------------------------------------
+
+// testSchema returns a schema using the sharedvalidation validators.
+func testSchema(t *testing.T) *Schema {
+	t.Helper()
+
+	s, err := NewSchema(
+		Key{Name: "ffmpeg.video-codec", Type: TypeString, Default: "h264", Validate: ValidVideoCodec, Aliases: []string{"codec"}},
+		Key{Name: "concurrency", Type: TypeInt, Default: 1, Validate: ValidConcurrencyLimit},
+		Key{Name: "max-cpu", Type: TypeFloat, Validate: ValidMaxCPU(false)},
+		Key{Name: "min-free-mem", Type: TypeString, Validate: ValidMinFreeMem},
+		Key{Name: "retry", Type: TypeDuration, Default: "30s"},
+	)
+	if err != nil {
+		t.Fatalf("new schema: %v", err)
+	}
+	return s
+}
+
+func TestSchemaLoad(t *testing.T) {
+	for name, c := range backends(t, map[string]any{
+		"codec":        "H264",
+		"concurrency":  "-3",
+		"max-cpu":      100,
+		"min-free-mem": "2gb",
+	}) {
+		t.Run(name, func(t *testing.T) {
+			if err := testSchema(t).Load(c); err != nil {
+				t.Fatalf("load: %v", err)
+			}
+
+			if got := c.GetString("ffmpeg.video-codec"); got != "h264" {
+				t.Errorf("expected codec from alias normalized to h264, got %q", got)
+			}
+			if got := c.GetInt("concurrency"); got != 1 {
+				t.Errorf("expected concurrency clamped to 1, got %d", got)
+			}
+			if got := c.GetFloat64("max-cpu"); got != 101 {
+				t.Errorf("expected max CPU 101, got %v", got)
+			}
+			if got := c.GetString("min-free-mem"); got != "2G" {
+				t.Errorf("expected normalized memory 2G, got %q", got)
+			}
+			if got := c.GetDuration("retry"); got != 30*time.Second || !c.IsSet("retry") {
+				t.Errorf("expected default retry of 30s, got %s", got)
+			}
+
+			// Values changed by their validator are Set, others keep their source.
+			for key, want := range map[string]Source{
+				"ffmpeg.video-codec": SourceOverride,
+				"concurrency":        SourceOverride,
+				"min-free-mem":       SourceOverride,
+				"codec":              SourceFile,
+				"retry":              SourceDefault,
+			} {
+				if got := c.Source(key); got != want {
+					t.Errorf("Source(%q) = %q, expected %q", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestSchemaErrors(t *testing.T) {
+	c := NewMemory(map[string]any{
+		"codec":        "divx",
+		"concurrency":  "many",
+		"min-free-mem": "2XB",
+		"retry":        "30",
+	})
+
+	err := testSchema(t).Load(c)
+	var errs SchemaErrors
+	if !errors.As(err, &errs) || len(errs) != 4 {
+		t.Fatalf("expected 4 schema errors, got %v", err)
+	}
+	if errs[0].Key != "codec" || !errors.Is(errs[0], sharederrors.ErrInvalidCodec) {
+		t.Errorf("expected codec alias error, got %v", errs[0])
+	}
+	if !errors.Is(err, sharederrors.ErrInvalidMemorySize) || !errors.Is(err, ErrParse) {
+		t.Errorf("expected sentinels through SchemaErrors, got %v", err)
+	}
+
+	if errs[1].Source != SourceFile {
+		t.Errorf("expected file source, got %q", errs[1].Source)
+	}
+
+	// Nothing applied on failure.
+	if c.IsSet("ffmpeg.video-codec") {
+		t.Errorf("expected no values applied after failed load")
+	}
+
+	// Directories are created only once every key is valid.
+	output := filepath.Join(t.TempDir(), "output")
+	dirSchema, err := NewSchema(
+		Key{Name: "output", Type: TypeString, Validate: ValidDirectory(true, nil)},
+		Key{Name: "concurrency", Type: TypeInt},
+	)
+	if err != nil {
+		t.Fatalf("new schema: %v", err)
+	}
+	c = NewMemory(map[string]any{"output": output, "concurrency": "many"})
+	if err := dirSchema.Load(c); !errors.Is(err, ErrParse) {
+		t.Fatalf("expected concurrency parse error, got %v", err)
+	}
+	if _, err := os.Stat(output); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("expected no directory created for a rejected config, got %v", err)
+	}
+	c.Set("concurrency", 2)
+	if err := dirSchema.Load(c); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if info, err := os.Stat(output); err != nil || !info.IsDir() {
+		t.Errorf("expected directory created, got %v", err)
+	}
+	if got := c.GetString("output"); got != output {
+		t.Errorf("expected output %q, got %q", output, got)
+	}
+
+	// Declaration errors.
+	if _, err := NewSchema(Key{Name: "a", Type: TypeInt}, Key{Name: "b", Type: TypeInt, Aliases: []string{"A"}}); err == nil {
+		t.Errorf("expected duplicate alias error")
+	}
+	if _, err := NewSchema(Key{Name: "a", Type: TypeInt, Default: "one"}); err == nil {
+		t.Errorf("expected invalid default error")
+	}
+}
@@ -0,0 +1,281 @@
+// Package abstractions provides a layer to interact with functions like Viper. Allows for future swapping out if required.
+package abstractions
+
+import (
+	"sync"
+	"time"
+)
+
+// Source is where a config value came from.
+type Source string
+
+// Value sources, in viper's precedence order (highest first).
+const (
+	SourceNone     Source = ""         // Not set.
+	SourceOverride Source = "override" // Set at runtime.
+	SourceFlag     Source = "flag"
+	SourceEnv      Source = "env"
+	SourceFile     Source = "file"
+	SourceDefault  Source = "default"
+	SourceUnknown  Source = "unknown" // Set through the backend directly, e.g. a flag bound on viper itself.
+)
+
+// Config is a configuration store. Keys are case-insensitive, with nested keys separated by dots.
+type Config interface {
+	// Get returns the value for the key, or nil if not set.
+	Get(key string) any
+	// GetBool returns the value for the key as a boolean.
+	GetBool(key string) bool
+	// GetInt returns the value for the key as an integer.
+	GetInt(key string) int
+	// GetUint64 returns the value for the key as an unsigned integer.
+	GetUint64(key string) uint64
+	// GetFloat64 returns the value for the key as a float64.
+	GetFloat64(key string) float64
+	// GetString returns the value for the key as a string.
+	GetString(key string) string
+	// GetStringSlice returns the value for the key as a slice of strings.
+	GetStringSlice(key string) []string
+	// GetDuration returns the value for the key as a duration.
+	GetDuration(key string) time.Duration
+
+	// Strict getters returning a *KeyError wrapping ErrNotSet, ErrWrongType or ErrParse. Check
+	// errors.Is(err, ErrNotSet) for optional keys.
+
+	// GetBoolE returns the value for the key as a boolean.
+	GetBoolE(key string) (bool, error)
+	// GetIntE returns the value for the key as an integer.
+	GetIntE(key string) (int, error)
+	// GetUint64E returns the value for the key as an unsigned integer.
+	GetUint64E(key string) (uint64, error)
+	// GetFloat64E returns the value for the key as a float64.
+	GetFloat64E(key string) (float64, error)
+	// GetStringE returns the value for the key as a string.
+	GetStringE(key string) (string, error)
+	// GetStringSliceE returns the value for the key as a slice of strings.
+	GetStringSliceE(key string) ([]string, error)
+	// GetDurationE returns the value for the key as a duration, which must have a unit (e.g. "30s").
+	GetDurationE(key string) (time.Duration, error)
+	// GetTimeE returns the value for the key as a time.
+	GetTimeE(key string) (time.Time, error)
+	// GetStringMapE returns the value for the key as a map.
+	GetStringMapE(key string) (map[string]any, error)
+	// GetStringMapStringE returns the value for the key as a map of strings.
+	GetStringMapStringE(key string) (map[string]string, error)
+	// GetIntSliceE returns the value for the key as a slice of integers.
+	GetIntSliceE(key string) ([]int, error)
+	// GetSizeInBytesE returns the value for the key as bytes, parsing sizes like "2GB".
+	GetSizeInBytesE(key string) (uint64, error)
+
+	// UnmarshalKey decodes the value for the key into out, using "mapstructure" tags for structs.
+	UnmarshalKey(key string, out any) error
+
+	// Set sets an override value for the key, taking precedence over all other sources.
+	Set(key string, value any)
+	// SetDefault sets the default value for the key, used if no other source sets it.
+	SetDefault(key string, value any)
+	// IsSet returns true if the key has a value in any source, including defaults.
+	IsSet(key string) bool
+	// Source returns where the key's value came from, SourceNone if not set.
+	Source(key string) Source
+	// AllKeys returns all keys holding a value.
+	AllKeys() []string
+
+	// Sub returns a copy of the config under the key, or nil if the key does not hold a map.
+	Sub(key string) Config
+	// Unmarshal decodes all settings into the struct pointed to by out, using "mapstructure" tags.
+	Unmarshal(out any) error
+	// Watch calls onChange after the underlying config source changes.
+	Watch(onChange func()) error
+}
+
+// Default returns the config used by the package-level functions.
+func Default() Config {
+	std.mu.RLock()
+	defer std.mu.RUnlock()
+	return std.c
+}
+
+// SetDefaultConfig replaces the config used by the package-level functions, e.g. with a MemoryConfig in tests.
+//
+// Call restore to put the previous config back.
+func SetDefaultConfig(c Config) (restore func()) {
+	std.mu.Lock()
+	prev := std.c
+	std.c = c
+	std.mu.Unlock()
+
+	return func() {
+		std.mu.Lock()
+		std.c = prev
+		std.mu.Unlock()
+	}
+}
+
+// Set sets the value for the key in the override register. Set is case-insensitive for a key.
+// Will be used instead of values obtained via flags, config file, ENV, default, or key/value store.
+func Set(key string, value any) {
+	Default().Set(key, value)
+}
+
+// SetDefault sets the default value for the key.
+func SetDefault(key string, value any) {
+	Default().SetDefault(key, value)
+}
+
+// Get can retrieve any value given the key to use. Get is case-insensitive for a key.
+// Get has the behavior of returning the value associated with the first place from where it is set.
+// Viper will check in the following order: override, flag, env, config file, key/value store, default.
+// Get returns an interface. For a specific value use one of the Get____ methods.
+func Get(key string) any {
+	return Default().Get(key)
+}
+
+// GetBool returns the value associated with the key as a boolean.
+func GetBool(key string) bool {
+	return Default().GetBool(key)
+}
+
+// GetInt returns the value associated with the key as an integer.
+func GetInt(key string) int {
+	return Default().GetInt(key)
+}
+
+// GetUint64 returns the value associated with the key as an unsigned integer.
+func GetUint64(key string) uint64 {
+	return Default().GetUint64(key)
+}
+
+// GetFloat64 returns the value associated with the key as a float64.
+func GetFloat64(key string) float64 {
+	return Default().GetFloat64(key)
+}
+
+// GetString returns the value associated with the key as a string.
+func GetString(key string) string {
+	return Default().GetString(key)
+}
+
+// GetStringSlice returns the value associated with the key as a slice of strings.
+func GetStringSlice(key string) []string {
+	return Default().GetStringSlice(key)
+}
+
+// GetDuration returns the value associated with the key as a duration.
+func GetDuration(key string) time.Duration {
+	return Default().GetDuration(key)
+}
+
+// GetBoolE returns the value associated with the key as a boolean, or a *KeyError.
+func GetBoolE(key string) (bool, error) {
+	return Default().GetBoolE(key)
+}
+
+// GetIntE returns the value associated with the key as an integer, or a *KeyError.
+func GetIntE(key string) (int, error) {
+	return Default().GetIntE(key)
+}
+
+// GetUint64E returns the value associated with the key as an unsigned integer, or a *KeyError.
+func GetUint64E(key string) (uint64, error) {
+	return Default().GetUint64E(key)
+}
+
+// GetFloat64E returns the value associated with the key as a float64, or a *KeyError.
+func GetFloat64E(key string) (float64, error) {
+	return Default().GetFloat64E(key)
+}
+
+// GetStringE returns the value associated with the key as a string, or a *KeyError.
+func GetStringE(key string) (string, error) {
+	return Default().GetStringE(key)
+}
+
+// GetStringSliceE returns the value associated with the key as a slice of strings, or a *KeyError.
+func GetStringSliceE(key string) ([]string, error) {
+	return Default().GetStringSliceE(key)
+}
+
+// GetDurationE returns the value associated with the key as a duration, or a *KeyError.
+func GetDurationE(key string) (time.Duration, error) {
+	return Default().GetDurationE(key)
+}
+
+// GetTimeE returns the value associated with the key as a time, or a *KeyError.
+func GetTimeE(key string) (time.Time, error) {
+	return Default().GetTimeE(key)
+}
+
+// GetStringMapE returns the value associated with the key as a map, or a *KeyError.
+func GetStringMapE(key string) (map[string]any, error) {
+	return Default().GetStringMapE(key)
+}
+
+// GetStringMapStringE returns the value associated with the key as a map of strings, or a *KeyError.
+func GetStringMapStringE(key string) (map[string]string, error) {
+	return Default().GetStringMapStringE(key)
+}
+
+// GetIntSliceE returns the value associated with the key as a slice of integers, or a *KeyError.
+func GetIntSliceE(key string) ([]int, error) {
+	return Default().GetIntSliceE(key)
+}
+
+// GetSizeInBytesE returns the value associated with the key as bytes, parsing sizes like "2GB", or a *KeyError.
+func GetSizeInBytesE(key string) (uint64, error) {
+	return Default().GetSizeInBytesE(key)
+}
+
+// UnmarshalKey decodes the value associated with the key into out.
+func UnmarshalKey(key string, out any) error {
+	return Default().UnmarshalKey(key, out)
+}
+
+// IsSet checks to see if the key has been set in any of the data locations.
+// IsSet is case-insensitive for a key.
+func IsSet(key string) bool {
+	return Default().IsSet(key)
+}
+
+// SourceOf returns where the key's value came from.
+func SourceOf(key string) Source {
+	return Default().Source(key)
+}
+
+// AllKeys returns all keys holding a value.
+func AllKeys() []string {
+	return Default().AllKeys()
+}
+
+// Sub returns a copy of the config under the key, or nil if the key does not hold a map.
+func Sub(key string) Config {
+	return Default().Sub(key)
+}
+
+// Unmarshal decodes all settings into the struct pointed to by out.
+func Unmarshal(out any) error {
+	return Default().Unmarshal(out)
+}
+
+// Watch calls onChange after the config file changes.
+//
+// The default ViperConfig watches until its Close is called.
+func Watch(onChange func()) error {
+	return Default().Watch(onChange)
+}
+
+// **** Private **********************************************************************************
+
+// Implementations.
+var (
+	_ Config = (*ViperConfig)(nil)
+	_ Config = (*MemoryConfig)(nil)
+	_ Config = (*ScopedConfig)(nil)
+	_ Config = (*SnapshotConfig)(nil)
+)
+
+// std is the config used by the package-level functions, the global viper instance by default.
+var std = struct {
+	mu sync.RWMutex
+	c  Config
+}{c: NewViper(nil)}
@@ -0,0 +1,160 @@
+package abstractions
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// Dump output formats.
+const (
+	DumpFormatYAML  = "yaml"
+	DumpFormatJSON  = "json"
+	DumpFormatTable = "table"
+)
+
+// MaskedValue replaces the value of secret keys in dumps and logs.
+const MaskedValue = "********"
+
+// SecretKeyWords mark a key as secret if its last segment contains one, e.g. "auth.api-key".
+var SecretKeyWords = []string{"password", "passwd", "secret", "token", "api-key", "apikey", "cookie", "credential"}
+
+// Setting is the effective value of a config key.
+type Setting struct {
+	Key    string `json:"key" yaml:"key"`
+	Value  any    `json:"value" yaml:"value"`                   // MaskedValue for set secret keys.
+	Source Source `json:"source" yaml:"source"`                 // SourceNone if not set.
+	Set    bool   `json:"set" yaml:"set"`                       // Set by a source other than a default.
+	File   string `json:"file,omitempty" yaml:"file,omitempty"` // File providing the value, if known.
+	Secret bool   `json:"secret,omitempty" yaml:"secret,omitempty"`
+}
+
+// DumpOptions adds detail to a dump.
+type DumpOptions struct {
+	Schema  *Schema      // Lists declared keys even if unset, and masks keys declared Secret.
+	Files   *ConfigFiles // Reports the file providing file values.
+	Secrets []string     // More keys to mask, including the keys below them.
+}
+
+// Dump returns every known key of c with its effective value and source, sorted by key.
+func Dump(c Config, opts DumpOptions) []Setting {
+	keys := c.AllKeys()
+	if opts.Schema != nil {
+		for _, k := range opts.Schema.keys {
+			keys = append(keys, strings.ToLower(k.Name))
+		}
+	}
+	slices.Sort(keys)
+	keys = slices.Compact(keys)
+
+	settings := make([]Setting, 0, len(keys))
+	for _, k := range keys {
+		s := Setting{
+			Key:    k,
+			Value:  c.Get(k),
+			Source: c.Source(k),
+			Secret: opts.isSecret(k),
+		}
+		s.Set = s.Source != SourceNone && s.Source != SourceDefault
+		if s.Source == SourceFile && opts.Files != nil {
+			s.File = opts.Files.FileOf(k)
+		}
+		if s.Secret && s.Value != nil {
+			s.Value = MaskedValue
+		}
+		settings = append(settings, s)
+	}
+	return settings
+}
+
+// WriteDump writes settings as YAML, JSON or an aligned text table.
+func WriteDump(w io.Writer, settings []Setting, format string) error {
+	switch strings.ToLower(format) {
+	case DumpFormatYAML:
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(settings); err != nil {
+			return err
+		}
+		return enc.Close()
+
+	case DumpFormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(settings)
+
+	case DumpFormatTable:
+		return writeDumpTable(w, settings)
+
+	default:
+		return fmt.Errorf("config dump format %q is not valid, expected %q, %q or %q", format, DumpFormatYAML, DumpFormatJSON, DumpFormatTable)
+	}
+}
+
+// **** Private **********************************************************************************
+
+// isSecret returns true if the key's value must be masked.
+func (o DumpOptions) isSecret(key string) bool {
+	for _, s := range o.Secrets {
+		if s = strings.ToLower(s); key == s || strings.HasPrefix(key, s+".") {
+			return true
+		}
+	}
+	return isSecretKey(o.Schema, key)
+}
+
+// isSecretKey returns true if the key is declared Secret in the schema (which may be nil), or its
+// name contains one of SecretKeyWords.
+func isSecretKey(s *Schema, key string) bool {
+	if s != nil {
+		if k, ok := s.Key(key); ok && k.Secret {
+			return true
+		}
+	}
+
+	name := strings.ToLower(key)
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		name = name[i+1:]
+	}
+	return slices.ContainsFunc(SecretKeyWords, func(word string) bool {
+		return strings.Contains(name, word)
+	})
+}
+
+// writeDumpTable writes settings as aligned columns, with a file column if any value came from a known file.
+func writeDumpTable(w io.Writer, settings []Setting) error {
+	withFiles := slices.ContainsFunc(settings, func(s Setting) bool { return s.File != "" })
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	header := "KEY\tVALUE\tSOURCE\tSET"
+	if withFiles {
+		header += "\tFILE"
+	}
+	fmt.Fprintln(tw, header)
+
+	for _, s := range settings {
+		value, source := "-", "-"
+		if s.Value != nil {
+			value = fmt.Sprint(s.Value)
+		}
+		if s.Source != SourceNone {
+			source = string(s.Source)
+		}
+		set := "no"
+		if s.Set {
+			set = "yes"
+		}
+
+		line := fmt.Sprintf("%s\t%s\t%s\t%s", s.Key, value, source, set)
+		if withFiles {
+			line += "\t" + s.File
+		}
+		fmt.Fprintln(tw, line)
+	}
+	return tw.Flush()
+}
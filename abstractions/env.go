@@ -0,0 +1,90 @@
+package abstractions
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// EnvKeyReplacer converts key separators for environment variable names, e.g. ffmpeg.hw-accel to FFMPEG_HW_ACCEL.
+var EnvKeyReplacer = strings.NewReplacer(".", "_", "-", "_")
+
+// EnvBinding binds config keys to environment variables named with a program prefix.
+//
+// With prefix "TUBARR", ffmpeg.hw-accel is read from TUBARR_FFMPEG_HW_ACCEL. Only listed keys are bound,
+// and empty variables are ignored.
+type EnvBinding struct {
+	Prefix   string            // Program prefix, e.g. "TUBARR" or "METARR".
+	Replacer *strings.Replacer // Converts key separators, EnvKeyReplacer if nil.
+	Keys     []string          // Keys to bind.
+}
+
+// EnvVar returns the environment variable name for the key.
+func (b EnvBinding) EnvVar(key string) string {
+	r := b.Replacer
+	if r == nil {
+		r = EnvKeyReplacer
+	}
+
+	name := strings.ToUpper(r.Replace(key))
+	if prefix := strings.TrimSuffix(b.Prefix, "_"); prefix != "" {
+		name = strings.ToUpper(prefix) + "_" + name
+	}
+	return name
+}
+
+// EnvVars returns the environment variable name for each bound key.
+func (b EnvBinding) EnvVars() map[string]string {
+	vars := make(map[string]string, len(b.Keys))
+	for _, key := range b.Keys {
+		vars[key] = b.EnvVar(key)
+	}
+	return vars
+}
+
+// Bind binds every listed key in c to its environment variable.
+func (b EnvBinding) Bind(c Config) error {
+	binder, ok := c.(envBinder)
+	if !ok {
+		return fmt.Errorf("config type %T does not support environment variables", c)
+	}
+
+	for _, key := range b.Keys {
+		if key == "" {
+			return errors.New("cannot bind environment variable to empty key")
+		}
+		if err := binder.bindEnv(key, b.EnvVar(key)); err != nil {
+			return fmt.Errorf("bind environment variable for key %q: %w", key, err)
+		}
+	}
+	return nil
+}
+
+// BindEnv binds environment variables in the default config.
+func BindEnv(b EnvBinding) error {
+	return b.Bind(Default())
+}
+
+// **** Private **********************************************************************************
+
+// envBinder is implemented by configs which can read keys from environment variables.
+type envBinder interface {
+	bindEnv(key string, names ...string) error
+}
+
+// Environment binding implementations.
+var (
+	_ envBinder = (*ViperConfig)(nil)
+	_ envBinder = (*MemoryConfig)(nil)
+)
+
+// lookupEnv returns the value of the first non-empty variable.
+func lookupEnv(names []string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,98 @@
+package abstractions
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/TubarrApp/gocommon/sharederrors"
+)
+
+// Config value errors, wrapped by KeyError.
+var (
+	ErrNotSet    = sharederrors.New("not set", sharederrors.KindNotFound)
+	ErrWrongType = sharederrors.New("wrong type", sharederrors.KindInvalidInput)
+	ErrParse     = sharederrors.New("parse failure", sharederrors.KindInvalidInput)
+)
+
+// KeyError is a problem with the value of a config key.
+type KeyError struct {
+	Key    string
+	Value  any    // The offending value, nil if not set.
+	Source Source // Where the value came from.
+	Err    error
+}
+
+// Error returns the key failure message.
+func (e *KeyError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "config key %q", e.Key)
+
+	if e.Value != nil {
+		fmt.Fprintf(&b, " (value %v", e.Value)
+		if e.Source != SourceNone {
+			fmt.Fprintf(&b, " from %s", e.Source)
+		}
+		b.WriteByte(')')
+	}
+	fmt.Fprintf(&b, ": %v", e.Err)
+	return b.String()
+}
+
+// Unwrap returns the underlying error.
+func (e *KeyError) Unwrap() error {
+	return e.Err
+}
+
+// SchemaErrors lists every problem found while loading a schema.
+type SchemaErrors []*KeyError
+
+// Error returns one line per problem.
+func (e SchemaErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, err := range e {
+		lines[i] = err.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Unwrap returns the key errors, so errors.Is matches any of their causes.
+func (e SchemaErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+	return errs
+}
+
+// **** Private **********************************************************************************
+
+// conversionError classifies a failed conversion of v as ErrWrongType or ErrParse.
+//
+// Errors already classified by the converter are returned as is. Otherwise maps, and slices for
+// scalar targets, can never convert and are the wrong type. Anything else (typically a string)
+// failed to parse.
+func conversionError(v any, want any, wantSlice, wantMap bool, err error) error {
+	if errors.Is(err, ErrWrongType) || errors.Is(err, ErrParse) {
+		return err
+	}
+
+	kind := reflect.ValueOf(v).Kind()
+	isMap := kind == reflect.Map
+	isSlice := kind == reflect.Slice || kind == reflect.Array
+
+	switch {
+	case isMap && !wantMap,
+		isSlice && !wantSlice && !wantMap,
+		wantMap && !isMap:
+		return fmt.Errorf("%w: expected %v, got %T", ErrWrongType, want, v)
+	default:
+		return fmt.Errorf("%w: expected %v: %w", ErrParse, want, err)
+	}
+}
+
+// decodeError classifies a failed decode into out as ErrWrongType.
+func decodeError(out any, err error) error {
+	return fmt.Errorf("%w: cannot decode into %T: %w", ErrWrongType, out, err)
+}
@@ -0,0 +1,279 @@
+package abstractions
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/TubarrApp/gocommon/sharederrors"
+	"github.com/spf13/viper"
+)
+
+// Layer is the precedence level of a config file.
+type Layer string
+
+// File layers, lowest precedence first.
+const (
+	LayerSystem Layer = "system" // e.g. /etc/tubarr/config.yaml.
+	LayerUser   Layer = "user"   // e.g. ~/.config/tubarr/config.yaml.
+	LayerRun    Layer = "run"    // Given for one run, e.g. with --config.
+)
+
+// FileExtensions are the config file formats searched for, in order.
+var FileExtensions = []string{"yaml", "yml", "toml", "json"}
+
+// ConfigFile is a config file found by a FileLoader.
+type ConfigFile struct {
+	Path  string
+	Layer Layer
+}
+
+// FileLoader finds and reads a program's config files.
+//
+// Files are layered: system values are replaced by user values, which are replaced by the per-run file.
+type FileLoader struct {
+	Program   string // Directory name in the search locations, e.g. "tubarr".
+	Name      string // File name without extension, "config" if empty.
+	Path      string // Per-run file, e.g. from a --config flag. Must exist if set.
+	SystemDir string // Replaces SystemConfigDir(Program) if set.
+	UserDir   string // Replaces UserConfigDir(Program) if set.
+}
+
+// SystemConfigDir returns the system-wide config directory for the program, /etc/<program>.
+func SystemConfigDir(program string) string {
+	return filepath.Join("/etc", program)
+}
+
+// UserConfigDir returns the user config directory for the program.
+//
+// This is $XDG_CONFIG_HOME/<program> if set, otherwise ~/.config/<program>.
+func UserConfigDir(program string) (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); filepath.IsAbs(dir) {
+		return filepath.Join(dir, program), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", program), nil
+}
+
+// Find returns the config files to load, lowest precedence first.
+//
+// Each search directory provides at most one file, the first of FileExtensions present.
+func (l FileLoader) Find() ([]ConfigFile, error) {
+	if l.Program == "" && (l.SystemDir == "" || l.UserDir == "") {
+		return nil, errors.New("config file loader has no program name")
+	}
+
+	var files []ConfigFile
+	if p, err := l.search(l.systemDir()); err != nil {
+		return nil, err
+	} else if p != "" {
+		files = append(files, ConfigFile{Path: p, Layer: LayerSystem})
+	}
+
+	// The user layer is skipped if there is no home directory.
+	if dir, err := l.userDir(); err == nil {
+		p, err := l.search(dir)
+		if err != nil {
+			return nil, err
+		}
+		if p != "" {
+			files = append(files, ConfigFile{Path: p, Layer: LayerUser})
+		}
+	}
+
+	if l.Path != "" {
+		info, err := os.Stat(l.Path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			return nil, &sharederrors.PathError{Op: "find config file", Path: l.Path, Err: sharederrors.ErrPathNotFound}
+		case err != nil:
+			return nil, &sharederrors.PathError{Op: "find config file", Path: l.Path, Cause: err}
+		case info.IsDir():
+			return nil, &sharederrors.PathError{Op: "find config file", Path: l.Path, Err: sharederrors.ErrNotAFile}
+		}
+		files = append(files, ConfigFile{Path: l.Path, Layer: LayerRun})
+	}
+	return files, nil
+}
+
+// Load finds and reads the config files, replacing the file values of c with the layered result.
+//
+// Nothing is applied if any file fails to read.
+func (l FileLoader) Load(c Config) (*ConfigFiles, error) {
+	fl, ok := c.(fileLoader)
+	if !ok {
+		return nil, fmt.Errorf("config type %T does not support loading files", c)
+	}
+
+	loaded, err := l.read()
+	if err != nil {
+		return nil, err
+	}
+	if err := fl.loadFiles(loaded.nested()); err != nil {
+		return nil, err
+	}
+	return loaded, nil
+}
+
+// LoadFiles loads config files into the default config.
+func LoadFiles(l FileLoader) (*ConfigFiles, error) {
+	return l.Load(Default())
+}
+
+// ConfigFiles records the files loaded by a FileLoader.
+type ConfigFiles struct {
+	files  []ConfigFile
+	values map[string]any    // Flattened keys to the layered value.
+	from   map[string]string // Flattened keys to the path providing the value.
+}
+
+// Files returns the loaded files, lowest precedence first.
+func (f *ConfigFiles) Files() []ConfigFile {
+	return slices.Clone(f.files)
+}
+
+// FileOf returns the path of the file providing the key, or "" if no file sets it.
+//
+// For a key holding a map, this is the highest precedence file setting any key below it.
+func (f *ConfigFiles) FileOf(key string) string {
+	key = strings.ToLower(key)
+	if p, ok := f.from[key]; ok {
+		return p
+	}
+
+	best := -1
+	for k, p := range f.from {
+		if strings.HasPrefix(k, key+".") {
+			best = max(best, slices.IndexFunc(f.files, func(cf ConfigFile) bool { return cf.Path == p }))
+		}
+	}
+	if best < 0 {
+		return ""
+	}
+	return f.files[best].Path
+}
+
+// Keys returns every key set by the files.
+func (f *ConfigFiles) Keys() []string {
+	keys := make([]string, 0, len(f.from))
+	for k := range f.from {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// **** Private **********************************************************************************
+
+// fileLoader is implemented by configs which can replace their config file values.
+type fileLoader interface {
+	loadFiles(values map[string]any) error
+}
+
+// File loading implementations.
+var (
+	_ fileLoader = (*ViperConfig)(nil)
+	_ fileLoader = (*MemoryConfig)(nil)
+)
+
+// systemDir returns the system search directory.
+func (l FileLoader) systemDir() string {
+	if l.SystemDir != "" {
+		return l.SystemDir
+	}
+	return SystemConfigDir(l.Program)
+}
+
+// userDir returns the user search directory.
+func (l FileLoader) userDir() (string, error) {
+	if l.UserDir != "" {
+		return l.UserDir, nil
+	}
+	return UserConfigDir(l.Program)
+}
+
+// search returns the first config file in dir, or "" if there is none.
+func (l FileLoader) search(dir string) (string, error) {
+	name := l.Name
+	if name == "" {
+		name = "config"
+	}
+
+	for _, ext := range FileExtensions {
+		p := filepath.Join(dir, name+"."+ext)
+		info, err := os.Stat(p)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			continue
+		case err != nil:
+			return "", &sharederrors.PathError{Op: "find config file", Path: p, Cause: err}
+		case info.Mode().IsRegular():
+			return p, nil
+		}
+	}
+	return "", nil
+}
+
+// read finds and reads the config files, layering their values.
+func (l FileLoader) read() (*ConfigFiles, error) {
+	found, err := l.Find()
+	if err != nil {
+		return nil, err
+	}
+
+	loaded := &ConfigFiles{
+		files:  found,
+		values: make(map[string]any),
+		from:   make(map[string]string),
+	}
+	for _, f := range found {
+		values, err := readConfigFile(f.Path)
+		if err != nil {
+			return nil, err
+		}
+		flat := make(map[string]any)
+		flattenInto(flat, "", values)
+		for k, v := range flat {
+			loaded.set(k, v, f.Path)
+		}
+	}
+	return loaded, nil
+}
+
+// set stores a file value, replacing values from earlier files for the key, its parents and its children.
+func (f *ConfigFiles) set(key string, value any, path string) {
+	for k := range f.values {
+		if related(k, key) {
+			delete(f.values, k)
+			delete(f.from, k)
+		}
+	}
+	f.values[key] = value
+	f.from[key] = path
+}
+
+// nested returns the layered values as a nested map.
+func (f *ConfigFiles) nested() map[string]any {
+	out := make(map[string]any)
+	for k, v := range f.values {
+		setNested(out, k, v)
+	}
+	return out
+}
+
+// readConfigFile decodes a config file in any format viper supports, by extension.
+func readConfigFile(path string) (map[string]any, error) {
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return nil, &sharederrors.PathError{Op: "read config file", Path: path, Cause: err}
+	}
+	return v.AllSettings(), nil
+}
@@ -0,0 +1,423 @@
+package abstractions
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/spf13/cast"
+)
+
+// MemoryConfig is an in-memory Config, e.g. for tests. Values convert between types the same way as viper.
+//
+// Precedence follows viper: overrides (Set), then bound environment variables, then loaded values
+// (Load, standing in for a config file), then defaults.
+type MemoryConfig struct {
+	mu        sync.RWMutex
+	overrides map[string]any
+	values    map[string]any
+	defaults  map[string]any
+	envs      map[string][]string // Bound environment variable names.
+	watchers  []func()
+}
+
+// NewMemory returns an in-memory config holding values as if loaded from a config file.
+func NewMemory(values map[string]any) *MemoryConfig {
+	c := &MemoryConfig{
+		overrides: make(map[string]any),
+		values:    make(map[string]any),
+		defaults:  make(map[string]any),
+		envs:      make(map[string][]string),
+	}
+	flattenInto(c.values, "", values)
+	return c
+}
+
+// Load replaces the loaded values, as if the config file was edited, then calls watchers.
+func (c *MemoryConfig) Load(values map[string]any) {
+	c.mu.Lock()
+	c.values = make(map[string]any)
+	flattenInto(c.values, "", values)
+	watchers := slices.Clone(c.watchers)
+	c.mu.Unlock()
+
+	for _, fn := range watchers {
+		fn()
+	}
+}
+
+// Get returns the value for the key, or nil if not set.
+func (c *MemoryConfig) Get(key string) any {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.get(key)
+}
+
+// GetBool returns the value for the key as a boolean.
+func (c *MemoryConfig) GetBool(key string) bool {
+	return cast.ToBool(c.Get(key))
+}
+
+// GetInt returns the value for the key as an integer.
+func (c *MemoryConfig) GetInt(key string) int {
+	return cast.ToInt(c.Get(key))
+}
+
+// GetUint64 returns the value for the key as an unsigned integer.
+func (c *MemoryConfig) GetUint64(key string) uint64 {
+	return cast.ToUint64(c.Get(key))
+}
+
+// GetFloat64 returns the value for the key as a float64.
+func (c *MemoryConfig) GetFloat64(key string) float64 {
+	return cast.ToFloat64(c.Get(key))
+}
+
+// GetString returns the value for the key as a string.
+func (c *MemoryConfig) GetString(key string) string {
+	return cast.ToString(c.Get(key))
+}
+
+// GetStringSlice returns the value for the key as a slice of strings.
+func (c *MemoryConfig) GetStringSlice(key string) []string {
+	return cast.ToStringSlice(c.Get(key))
+}
+
+// GetDuration returns the value for the key as a duration.
+func (c *MemoryConfig) GetDuration(key string) time.Duration {
+	return cast.ToDuration(c.Get(key))
+}
+
+// GetBoolE returns the value for the key as a boolean.
+func (c *MemoryConfig) GetBoolE(key string) (bool, error) {
+	return c.typed().boolE(key)
+}
+
+// GetIntE returns the value for the key as an integer.
+func (c *MemoryConfig) GetIntE(key string) (int, error) {
+	return c.typed().intE(key)
+}
+
+// GetUint64E returns the value for the key as an unsigned integer.
+func (c *MemoryConfig) GetUint64E(key string) (uint64, error) {
+	return c.typed().uint64E(key)
+}
+
+// GetFloat64E returns the value for the key as a float64.
+func (c *MemoryConfig) GetFloat64E(key string) (float64, error) {
+	return c.typed().float64E(key)
+}
+
+// GetStringE returns the value for the key as a string.
+func (c *MemoryConfig) GetStringE(key string) (string, error) {
+	return c.typed().stringE(key)
+}
+
+// GetStringSliceE returns the value for the key as a slice of strings.
+func (c *MemoryConfig) GetStringSliceE(key string) ([]string, error) {
+	return c.typed().stringSliceE(key)
+}
+
+// GetDurationE returns the value for the key as a duration.
+func (c *MemoryConfig) GetDurationE(key string) (time.Duration, error) {
+	return c.typed().durationE(key)
+}
+
+// GetTimeE returns the value for the key as a time.
+func (c *MemoryConfig) GetTimeE(key string) (time.Time, error) {
+	return c.typed().timeE(key)
+}
+
+// GetStringMapE returns the value for the key as a map.
+func (c *MemoryConfig) GetStringMapE(key string) (map[string]any, error) {
+	return c.typed().stringMapE(key)
+}
+
+// GetStringMapStringE returns the value for the key as a map of strings.
+func (c *MemoryConfig) GetStringMapStringE(key string) (map[string]string, error) {
+	return c.typed().stringMapStringE(key)
+}
+
+// GetIntSliceE returns the value for the key as a slice of integers.
+func (c *MemoryConfig) GetIntSliceE(key string) ([]int, error) {
+	return c.typed().intSliceE(key)
+}
+
+// GetSizeInBytesE returns the value for the key as bytes, parsing sizes like "2GB".
+func (c *MemoryConfig) GetSizeInBytesE(key string) (uint64, error) {
+	return c.typed().sizeInBytesE(key)
+}
+
+// UnmarshalKey decodes the value for the key into out.
+func (c *MemoryConfig) UnmarshalKey(key string, out any) error {
+	return c.typed().unmarshalKey(key, out)
+}
+
+// Set sets an override value for the key.
+func (c *MemoryConfig) Set(key string, value any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	setFlat(c.overrides, key, value)
+}
+
+// SetDefault sets the default value for the key.
+func (c *MemoryConfig) SetDefault(key string, value any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	setFlat(c.defaults, key, value)
+}
+
+// IsSet returns true if the key has a value in any source, including defaults.
+func (c *MemoryConfig) IsSet(key string) bool {
+	return c.Get(key) != nil
+}
+
+// Source returns where the key's value came from: override (Set), env, file (loaded values) or default.
+func (c *MemoryConfig) Source(key string) Source {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.source(key)
+}
+
+// AllKeys returns all keys holding a value, sorted.
+func (c *MemoryConfig) AllKeys() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.allKeys()
+}
+
+// Sub returns a copy of the config under the key, or nil if the key does not hold a map.
+func (c *MemoryConfig) Sub(key string) Config {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if _, ok := c.get(key).(map[string]any); !ok {
+		return nil
+	}
+
+	prefix := strings.ToLower(key) + "."
+	sub := NewMemory(nil)
+	for _, pair := range []struct{ from, to map[string]any }{
+		{c.overrides, sub.overrides},
+		{c.values, sub.values},
+		{c.defaults, sub.defaults},
+	} {
+		for k, v := range pair.from {
+			if rest, ok := strings.CutPrefix(k, prefix); ok {
+				pair.to[rest] = v
+			}
+		}
+	}
+	for k, names := range c.envs {
+		if rest, ok := strings.CutPrefix(k, prefix); ok {
+			sub.envs[rest] = names
+		}
+	}
+	return sub
+}
+
+// Unmarshal decodes all settings into the struct pointed to by out.
+func (c *MemoryConfig) Unmarshal(out any) error {
+	c.mu.RLock()
+	settings := c.allSettings()
+	c.mu.RUnlock()
+
+	return decode(settings, out)
+}
+
+// bindEnv binds environment variables to the key.
+func (c *MemoryConfig) bindEnv(key string, names ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.envs[strings.ToLower(key)] = names
+	return nil
+}
+
+// loadFiles replaces the loaded values with the layered values from a FileLoader.
+func (c *MemoryConfig) loadFiles(values map[string]any) error {
+	c.Load(values)
+	return nil
+}
+
+// Watch calls onChange after each Load.
+func (c *MemoryConfig) Watch(onChange func()) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.watchers = append(c.watchers, onChange)
+	return nil
+}
+
+// **** Private **********************************************************************************
+
+// typed returns the error-returning getters.
+func (c *MemoryConfig) typed() typedGetters {
+	return typedGetters{get: c.Get, sub: c.Sub, source: c.Source}
+}
+
+// source returns where the key's value came from, the caller holds mu.
+func (c *MemoryConfig) source(key string) Source {
+	if c.get(key) == nil {
+		return SourceNone
+	}
+
+	for i, layer := range c.layers() {
+		if hasKeyOrChild(layer, key) {
+			return []Source{SourceOverride, SourceEnv, SourceFile, SourceDefault}[i]
+		}
+	}
+	return SourceUnknown
+}
+
+// allKeys returns all keys holding a value, sorted, the caller holds mu.
+func (c *MemoryConfig) allKeys() []string {
+	keys := make(map[string]struct{})
+	for _, layer := range c.layers() {
+		for k := range layer {
+			keys[k] = struct{}{}
+		}
+	}
+	return slices.Sorted(maps.Keys(keys))
+}
+
+// layers returns the value layers, highest precedence first.
+func (c *MemoryConfig) layers() []map[string]any {
+	return []map[string]any{c.overrides, c.envValues(), c.values, c.defaults}
+}
+
+// envValues returns the bound environment variables currently set.
+func (c *MemoryConfig) envValues() map[string]any {
+	values := make(map[string]any, len(c.envs))
+	for k, names := range c.envs {
+		if v := lookupEnv(names); v != "" {
+			values[k] = v
+		}
+	}
+	return values
+}
+
+// get returns the value for the key, or a nested map of the keys below it.
+func (c *MemoryConfig) get(key string) any {
+	key = strings.ToLower(key)
+	for _, layer := range c.layers() {
+		if v, ok := layer[key]; ok {
+			return v
+		}
+	}
+
+	// Nested keys, lower layers first so higher layers overwrite.
+	prefix := key + "."
+	var nested map[string]any
+	layers := c.layers()
+	for i := len(layers) - 1; i >= 0; i-- {
+		for k, v := range layers[i] {
+			if rest, ok := strings.CutPrefix(k, prefix); ok {
+				if nested == nil {
+					nested = make(map[string]any)
+				}
+				setNested(nested, rest, v)
+			}
+		}
+	}
+	if nested == nil {
+		return nil
+	}
+	return nested
+}
+
+// allSettings returns every key as a nested map.
+func (c *MemoryConfig) allSettings() map[string]any {
+	out := make(map[string]any)
+	layers := c.layers()
+	for i := len(layers) - 1; i >= 0; i-- {
+		for k, v := range layers[i] {
+			setNested(out, k, v)
+		}
+	}
+	return out
+}
+
+// decode decodes settings into out the way viper does.
+func decode(input any, out any) error {
+	dec, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(
+			mapstructure.StringToTimeDurationHookFunc(),
+			mapstructure.StringToSliceHookFunc(","),
+		),
+		WeaklyTypedInput: true,
+		Result:           out,
+	})
+	if err != nil {
+		return err
+	}
+	return dec.Decode(input)
+}
+
+// hasKeyOrChild returns true if the layer holds the key, or keys nested below it.
+func hasKeyOrChild(layer map[string]any, key string) bool {
+	key = strings.ToLower(key)
+	if _, ok := layer[key]; ok {
+		return true
+	}
+	prefix := key + "."
+	for k := range layer {
+		if strings.HasPrefix(k, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// setFlat stores value under key, replacing anything previously stored below the key.
+func setFlat(layer map[string]any, key string, value any) {
+	key = strings.ToLower(key)
+	prefix := key + "."
+	for k := range layer {
+		if k == key || strings.HasPrefix(k, prefix) {
+			delete(layer, k)
+		}
+	}
+	flattenInto(layer, key, value)
+}
+
+// flattenInto stores value in layer under dotted lowercase keys, expanding nested maps.
+func flattenInto(layer map[string]any, key string, value any) {
+	var m map[string]any
+	switch v := value.(type) {
+	case map[string]any:
+		m = v
+	case map[any]any:
+		m = cast.ToStringMap(v)
+	case map[string]string:
+		m = cast.ToStringMap(v)
+	default:
+		if key != "" {
+			layer[key] = value
+		}
+		return
+	}
+
+	for k, v := range m {
+		k = strings.ToLower(k)
+		if key != "" {
+			k = key + "." + k
+		}
+		flattenInto(layer, k, v)
+	}
+}
+
+// setNested stores value in a nested map under a dotted key.
+func setNested(m map[string]any, key string, value any) {
+	parts := strings.Split(key, ".")
+	for _, part := range parts[:len(parts)-1] {
+		next, ok := m[part].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			m[part] = next
+		}
+		m = next
+	}
+	m[parts[len(parts)-1]] = value
+}
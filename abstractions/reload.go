@@ -0,0 +1,429 @@
+package abstractions
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/TubarrApp/gocommon/logging"
+	"github.com/fsnotify/fsnotify"
+)
+
+// ReloadDelay is how long a Reloader waits after a file event before reloading, so that editors
+// writing a file in several steps cause one reload.
+var ReloadDelay = 200 * time.Millisecond
+
+// Reloader keeps a config's file values in sync with its config files.
+//
+// Edited files are validated against the schema before they are applied. Rejected edits are logged
+// and the previous values kept.
+type Reloader struct {
+	c       Config
+	loader  FileLoader
+	schema  *Schema
+	log     *logging.ProgramLogger
+	changes *changeNotifier
+
+	mu    sync.Mutex // Serializes reloads.
+	files *ConfigFiles
+
+	timerMu sync.Mutex
+	timer   *time.Timer
+	closed  atomic.Bool
+	watcher *fsnotify.Watcher
+	dirs    []string // Directories which hold, or may later hold, config files.
+}
+
+// NewReloader loads the config files into c and watches them for changes until Close.
+//
+// The schema may be nil. Changes and rejected edits are logged to log, if not nil.
+func NewReloader(c Config, loader FileLoader, schema *Schema, log *logging.ProgramLogger) (*Reloader, error) {
+	return newReloader(c, loader, schema, log, &changeNotifier{})
+}
+
+// WatchFiles loads config files into the default config and watches them for changes.
+//
+// Functions registered with the package-level OnChange are called on changes.
+func WatchFiles(loader FileLoader, schema *Schema, log *logging.ProgramLogger) (*Reloader, error) {
+	return newReloader(Default(), loader, schema, log, &stdChanges)
+}
+
+// OnChange calls fn with the old and new values when a reload changes the key, or any key below it.
+//
+// Call remove to stop notifications.
+func (r *Reloader) OnChange(key string, fn func(old, new any)) (remove func()) {
+	return r.changes.add(key, fn)
+}
+
+// OnChange calls fn when files watched by WatchFiles change the key, or any key below it.
+func OnChange(key string, fn func(old, new any)) (remove func()) {
+	return stdChanges.add(key, fn)
+}
+
+// Files returns the config files currently loaded.
+func (r *Reloader) Files() *ConfigFiles {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.files
+}
+
+// Reload reads the config files and applies them if valid, notifying changed keys.
+//
+// If a file cannot be read or the result fails the schema, the previous values are kept and the
+// error is returned.
+func (r *Reloader) Reload() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.logReload()
+}
+
+// Close stops watching the config files, and waits for a reload in progress.
+func (r *Reloader) Close() error {
+	r.timerMu.Lock()
+	r.closed.Store(true)
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+	r.timerMu.Unlock()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.watcher.Close()
+}
+
+// **** Private **********************************************************************************
+
+// stdChanges holds the functions registered with the package-level OnChange.
+var stdChanges changeNotifier
+
+// newReloader performs the initial load and starts the watcher.
+func newReloader(c Config, loader FileLoader, schema *Schema, log *logging.ProgramLogger, changes *changeNotifier) (*Reloader, error) {
+	if _, ok := c.(fileLoader); !ok {
+		return nil, fmt.Errorf("config type %T does not support loading files", c)
+	}
+
+	if log == nil {
+		log = logging.NewProgramLogger("config", io.Discard, io.Discard)
+	}
+
+	r := &Reloader{c: c, loader: loader, schema: schema, log: log, changes: changes}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	r.watcher = w
+	r.dirs = r.watchDirs()
+	r.watch()
+	go r.run()
+	return r, nil
+}
+
+// reload reads, validates and applies the config files, logging and notifying changes after the initial load.
+func (r *Reloader) reload() error {
+	files, err := r.loader.read()
+	if err != nil {
+		return err
+	}
+
+	// Check the new values, and create directories requested by validators.
+	var checked []checkedValue
+	if r.schema != nil {
+		if checked, err = r.schema.check(r.candidate(files)); err != nil {
+			return err
+		}
+		if err := prepare(checked); err != nil {
+			return err
+		}
+	}
+
+	keys := r.changes.keys()
+	before := values(r.c, r.c.AllKeys())
+	beforeWatched := values(r.c, keys)
+
+	// Values from other sources and defaults first, they are hidden by the files they were read
+	// over. Then the normalized file values, replacing the previous ones in one step.
+	for _, v := range checked {
+		if v.source != SourceFile {
+			v.apply(r.c)
+		}
+	}
+	if err := r.c.(fileLoader).loadFiles(fileValues(files, checked)); err != nil {
+		return err
+	}
+
+	initial := r.files == nil
+	r.files = files
+	if initial {
+		return nil
+	}
+
+	after := values(r.c, r.c.AllKeys())
+	changed := diff(before, after)
+	for _, k := range changed {
+		if isSecretKey(r.schema, k) {
+			r.log.I("Config %q changed", k)
+			continue
+		}
+		r.log.I("Config %q changed: %v -> %v", k, before[k], after[k])
+	}
+	r.changes.notify(changed, beforeWatched, values(r.c, keys))
+	return nil
+}
+
+// candidate returns a config holding the new file values, overridden by the values from
+// sources above files in c.
+func (r *Reloader) candidate(files *ConfigFiles) Config {
+	cand := NewMemory(files.nested())
+	for _, k := range r.c.AllKeys() {
+		switch r.c.Source(k) {
+		case SourceOverride, SourceFlag, SourceEnv, SourceUnknown:
+			if v := r.c.Get(k); v != nil {
+				cand.Set(k, v)
+			}
+		}
+	}
+	return cand
+}
+
+// fileValues returns the file values as a nested map, with the checked values read from files normalized.
+func fileValues(files *ConfigFiles, checked []checkedValue) map[string]any {
+	out := files.nested()
+	for _, v := range checked {
+		if v.source == SourceFile {
+			setNested(out, strings.ToLower(v.key), v.value)
+		}
+	}
+	return out
+}
+
+// watchDirs returns the directories holding config files, or which may hold them later.
+func (r *Reloader) watchDirs() []string {
+	dirs := []string{r.loader.systemDir()}
+	if dir, err := r.loader.userDir(); err == nil {
+		dirs = append(dirs, dir)
+	}
+	if r.loader.Path != "" {
+		dirs = append(dirs, filepath.Dir(r.loader.Path))
+	}
+	for i, dir := range dirs {
+		dirs[i] = filepath.Clean(dir)
+	}
+	slices.Sort(dirs)
+	return slices.Compact(dirs)
+}
+
+// watch adds each config directory to the watcher. Missing directories are watched through their
+// nearest existing parent, until they are created.
+func (r *Reloader) watch() {
+	for _, dir := range r.dirs {
+		for {
+			if _, err := os.Stat(dir); err == nil || !errors.Is(err, fs.ErrNotExist) {
+				break
+			}
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+			dir = parent
+		}
+		if err := r.watcher.Add(dir); err != nil {
+			r.log.W("Cannot watch config directory %q: %v", dir, err)
+		}
+	}
+}
+
+// isConfigDir returns true if the path is a config directory, or one of its parents.
+func (r *Reloader) isConfigDir(path string) bool {
+	path = filepath.Clean(path)
+	return slices.ContainsFunc(r.dirs, func(dir string) bool {
+		return dir == path || strings.HasPrefix(dir, path+string(filepath.Separator))
+	})
+}
+
+// isConfigFile returns true if the path may be one of the loader's config files.
+func (r *Reloader) isConfigFile(path string) bool {
+	if r.loader.Path != "" && filepath.Clean(path) == filepath.Clean(r.loader.Path) {
+		return true
+	}
+	if !slices.Contains(r.dirs, filepath.Dir(path)) {
+		return false
+	}
+
+	name := r.loader.Name
+	if name == "" {
+		name = "config"
+	}
+	for _, ext := range FileExtensions {
+		if filepath.Base(path) == name+"."+ext {
+			return true
+		}
+	}
+	return false
+}
+
+// run reloads after config file events until the watcher is closed.
+func (r *Reloader) run() {
+	for {
+		select {
+		case ev, ok := <-r.watcher.Events:
+			if !ok {
+				return
+			}
+			switch {
+			case ev.Has(fsnotify.Create) && r.isConfigDir(ev.Name):
+				// Watch the created directory, files may have been written before it was added.
+				r.watch()
+				r.schedule()
+			case r.isConfigFile(ev.Name) && !ev.Has(fsnotify.Chmod):
+				r.schedule()
+			}
+		case err, ok := <-r.watcher.Errors:
+			if !ok {
+				return
+			}
+			r.log.W("Config file watcher error: %v", err)
+		}
+	}
+}
+
+// schedule reloads after ReloadDelay, restarting the delay on each call.
+func (r *Reloader) schedule() {
+	r.timerMu.Lock()
+	defer r.timerMu.Unlock()
+
+	if r.closed.Load() {
+		return
+	}
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+	r.timer = time.AfterFunc(ReloadDelay, r.reloadOpen)
+}
+
+// reloadOpen reloads unless the reloader was closed.
+func (r *Reloader) reloadOpen() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.closed.Load() {
+		_ = r.logReload()
+	}
+}
+
+// logReload reloads, logging rejected edits.
+func (r *Reloader) logReload() error {
+	if err := r.reload(); err != nil {
+		r.log.E("Config reload rejected, keeping previous values:\n%v", err)
+		return err
+	}
+	return nil
+}
+
+// changeListener is a function registered with OnChange.
+type changeListener struct {
+	key string
+	fn  func(old, new any)
+}
+
+// changeNotifier dispatches changed keys to listeners.
+type changeNotifier struct {
+	mu        sync.Mutex
+	next      int
+	listeners map[int]changeListener
+}
+
+// add registers a listener.
+func (n *changeNotifier) add(key string, fn func(old, new any)) (remove func()) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.listeners == nil {
+		n.listeners = make(map[int]changeListener)
+	}
+	id := n.next
+	n.next++
+	n.listeners[id] = changeListener{key: strings.ToLower(key), fn: fn}
+
+	return func() {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		delete(n.listeners, id)
+	}
+}
+
+// keys returns the keys listened to.
+func (n *changeNotifier) keys() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var keys []string
+	for _, l := range n.listeners {
+		keys = append(keys, l.key)
+	}
+	return keys
+}
+
+// notify calls each listener whose key (or a key below it) changed, with its old and new values.
+func (n *changeNotifier) notify(changed []string, before, after map[string]any) {
+	n.mu.Lock()
+	listeners := slices.Collect(maps.Values(n.listeners))
+	n.mu.Unlock()
+
+	for _, l := range listeners {
+		if slices.ContainsFunc(changed, func(k string) bool { return related(l.key, k) }) {
+			l.fn(before[l.key], after[l.key])
+		}
+	}
+}
+
+// values returns the value of each key. Maps are rebuilt from the keys below them, so they hold values from every source.
+func values(c Config, keys []string) map[string]any {
+	all := c.AllKeys()
+	out := make(map[string]any, len(keys))
+	for _, k := range keys {
+		k = strings.ToLower(k)
+		v := c.Get(k)
+		if _, ok := v.(map[string]any); ok {
+			m := make(map[string]any)
+			for _, child := range all {
+				if rest, ok := strings.CutPrefix(child, k+"."); ok {
+					setNested(m, rest, c.Get(child))
+				}
+			}
+			v = m
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// diff returns the sorted keys whose values differ.
+func diff(before, after map[string]any) []string {
+	var changed []string
+	for k, v := range before {
+		if !reflect.DeepEqual(v, after[k]) {
+			changed = append(changed, k)
+		}
+	}
+	for k := range after {
+		if _, ok := before[k]; !ok {
+			changed = append(changed, k)
+		}
+	}
+	slices.Sort(changed)
+	return changed
+}
@@ -0,0 +1,261 @@
+package abstractions
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cast"
+)
+
+// Type is the value type of a schema key.
+type Type string
+
+// Key types.
+const (
+	TypeString      Type = "string"
+	TypeInt         Type = "int"
+	TypeBool        Type = "bool"
+	TypeFloat       Type = "float"
+	TypeStringSlice Type = "[]string"
+	TypeDuration    Type = "duration"
+	TypeSize        Type = "size" // Bytes as uint64, from a count or a size like "2GB".
+)
+
+// Key describes a config key in a schema.
+type Key struct {
+	Name        string
+	Type        Type
+	Default     any // Used if neither the key nor an alias is set, nil leaves the key unset.
+	Description string
+	Aliases     []string  // Other names read if Name is not set, e.g. a renamed key.
+	Validate    Validator // Optional check, returning the normalized value.
+	Secret      bool      // Masked in dumps and logs, e.g. a password.
+}
+
+// Schema is a set of declared config keys.
+type Schema struct {
+	keys   []Key
+	byName map[string]int // Lowercase names and aliases to key index.
+}
+
+// NewSchema checks the keys and returns a schema.
+//
+// Names and aliases must be unique, and defaults must convert to the key type.
+func NewSchema(keys ...Key) (*Schema, error) {
+	s := &Schema{
+		keys:   slices.Clone(keys),
+		byName: make(map[string]int, len(keys)),
+	}
+
+	for i, k := range s.keys {
+		if k.Name == "" {
+			return nil, fmt.Errorf("schema key %d has no name", i)
+		}
+		if _, ok := converters[k.Type]; !ok {
+			return nil, fmt.Errorf("schema key %q has invalid type %q", k.Name, k.Type)
+		}
+		if k.Default != nil {
+			if _, err := convert(k.Type, k.Default); err != nil {
+				return nil, fmt.Errorf("schema key %q has invalid default: %w", k.Name, err)
+			}
+		}
+
+		for _, name := range append([]string{k.Name}, k.Aliases...) {
+			name = strings.ToLower(name)
+			if _, dup := s.byName[name]; dup {
+				return nil, fmt.Errorf("schema key or alias %q is declared twice", name)
+			}
+			s.byName[name] = i
+		}
+	}
+	return s, nil
+}
+
+// Keys returns the declared keys in declaration order.
+func (s *Schema) Keys() []Key {
+	return slices.Clone(s.keys)
+}
+
+// Key returns the declared key for a name or alias.
+func (s *Schema) Key(name string) (Key, bool) {
+	i, ok := s.byName[strings.ToLower(name)]
+	if !ok {
+		return Key{}, false
+	}
+	return s.keys[i], true
+}
+
+// Load reads every declared key from c, converts it to the key type and runs its validator.
+//
+// If every key is valid, directories requested by validators are created, then the normalized values
+// are applied to c: Set if the validator changed the value (or it was read from an alias), and
+// SetDefault for defaults. Values only converted to the key type keep their source. Otherwise
+// nothing is applied, and the returned error is SchemaErrors listing every problem.
+//
+// Set values are overrides, so they hide later edits of the key in a config file. Pass the schema
+// to a Reloader for config files which are reloaded, it normalizes the file values instead.
+func (s *Schema) Load(c Config) error {
+	values, err := s.check(c)
+	if err != nil {
+		return err
+	}
+	if err := prepare(values); err != nil {
+		return err
+	}
+	for _, v := range values {
+		v.apply(c)
+	}
+	return nil
+}
+
+// LoadSchema loads the schema into the default config.
+func LoadSchema(s *Schema) error {
+	return s.Load(Default())
+}
+
+// **** Private **********************************************************************************
+
+// checkedValue is a normalized value ready to apply.
+type checkedValue struct {
+	key     string
+	from    string // Key or alias read, empty for the default.
+	source  Source // Source of the value read.
+	raw     any    // Value read, before conversion and validation.
+	typed   any    // Value converted to the key type, before validation.
+	value   any
+	prepare func() error // Run once every key is valid, e.g. to create a directory.
+}
+
+// check converts and validates every key, returning the normalized values or every problem found.
+func (s *Schema) check(c Config) ([]checkedValue, error) {
+	var (
+		values []checkedValue
+		errs   SchemaErrors
+	)
+
+	for _, k := range s.keys {
+		// Resolve from the key, then aliases, then the default.
+		from, v := k.Name, c.Get(k.Name)
+		for _, alias := range k.Aliases {
+			if v != nil {
+				break
+			}
+			from, v = alias, c.Get(alias)
+		}
+		source := SourceDefault
+		if v == nil {
+			from, v = "", k.Default
+		} else {
+			source = c.Source(from)
+		}
+		if v == nil {
+			continue
+		}
+
+		typed, err := convert(k.Type, v)
+		if err != nil {
+			errs = append(errs, &KeyError{Key: keyOrName(from, k.Name), Value: v, Source: source, Err: err})
+			continue
+		}
+
+		value := typed
+		var prep func() error
+		if k.Validate != nil {
+			if value, err = k.Validate(typed); err != nil {
+				errs = append(errs, &KeyError{Key: keyOrName(from, k.Name), Value: v, Source: source, Err: err})
+				continue
+			}
+			if d, ok := value.(deferred); ok {
+				value, prep = d.value, d.prepare
+			}
+		}
+		values = append(values, checkedValue{key: k.Name, from: from, source: source, raw: v, typed: typed, value: value, prepare: prep})
+	}
+
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return values, nil
+}
+
+// prepare runs the side effects of checked values, e.g. creating directories, returning every failure.
+func prepare(values []checkedValue) error {
+	var errs SchemaErrors
+	for _, v := range values {
+		if v.prepare == nil {
+			continue
+		}
+		if err := v.prepare(); err != nil {
+			errs = append(errs, &KeyError{Key: keyOrName(v.from, v.key), Value: v.raw, Source: v.source, Err: err})
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// apply sets the value on c if it is a default, was read from an alias or was changed by its validator.
+func (v checkedValue) apply(c Config) {
+	switch {
+	case v.from == "":
+		setValue(c, v.key, v.value, true)
+	case v.from != v.key || !reflect.DeepEqual(v.typed, v.value):
+		setValue(c, v.key, v.value, false)
+	}
+}
+
+// setValue applies a normalized value, or a default, to c.
+//
+// Scopes apply values to the scoped or global key they were read from, and defaults to the global
+// key, so a later global value is not hidden in the scope.
+func setValue(c Config, key string, value any, isDefault bool) {
+	if s, ok := c.(*ScopedConfig); ok {
+		k := s.global(key)
+		if !isDefault && s.parent.IsSet(s.scoped(key)) {
+			k = s.scoped(key)
+		}
+		setValue(s.parent, k, value, isDefault)
+		return
+	}
+
+	if isDefault {
+		c.SetDefault(key, value)
+	} else {
+		c.Set(key, value)
+	}
+}
+
+// keyOrName returns the key read, or the declared name for a default.
+func keyOrName(from, name string) string {
+	if from == "" {
+		return name
+	}
+	return from
+}
+
+// converters convert a value to each key type.
+var converters = map[Type]func(any) (any, error){
+	TypeString:      func(v any) (any, error) { return cast.ToStringE(v) },
+	TypeInt:         func(v any) (any, error) { return toInt(v) },
+	TypeBool:        func(v any) (any, error) { return toBool(v) },
+	TypeFloat:       func(v any) (any, error) { return toFloat64(v) },
+	TypeStringSlice: func(v any) (any, error) { return cast.ToStringSliceE(v) },
+	TypeDuration:    func(v any) (any, error) { return toDuration(v) },
+	TypeSize:        func(v any) (any, error) { return toSize(v) },
+}
+
+// convert converts v to the key type.
+func convert(t Type, v any) (any, error) {
+	conv, ok := converters[t]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown type %q", ErrWrongType, t)
+	}
+	out, err := conv(v)
+	if err != nil {
+		return nil, conversionError(v, t, t == TypeStringSlice, false, err)
+	}
+	return out, nil
+}
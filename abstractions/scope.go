@@ -0,0 +1,298 @@
+package abstractions
+
+import (
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+)
+
+// ScopedConfig is a view of a config under a prefix, e.g. "channels.news", which falls back to the
+// global key when the scoped key is not set.
+//
+// With prefix "channels.news", GetString("output") returns channels.news.output if set, otherwise
+// output. Maps are merged, with scoped keys replacing global ones.
+//
+// A ScopedConfig holds no state of its own, and each call reads the viewed config under its lock.
+// Views of a ViperConfig or MemoryConfig may be used concurrently, but a key resolved by several
+// calls (e.g. IsSet then Get) may change between them.
+type ScopedConfig struct {
+	parent   Config
+	prefix   string // Scoped keys are read under this prefix.
+	fallback string // Global keys are read under this prefix, empty at the top level.
+}
+
+// Resolved is where a scoped lookup found its value.
+type Resolved struct {
+	Key    string // Full key read, e.g. "channels.news.output" or "output".
+	Scoped bool   // True if the scoped key was set, false for the global fallback.
+	Source Source
+}
+
+// NewScope returns a view of c under the prefix, falling back to global keys.
+func NewScope(c Config, prefix string) *ScopedConfig {
+	return &ScopedConfig{parent: c, prefix: strings.Trim(strings.ToLower(prefix), ".")}
+}
+
+// Scope returns a view of the default config under the prefix, falling back to global keys.
+func Scope(prefix string) *ScopedConfig {
+	return NewScope(Default(), prefix)
+}
+
+// Prefix returns the prefix of scoped keys.
+func (s *ScopedConfig) Prefix() string {
+	return s.prefix
+}
+
+// Resolve returns where the key's value is read from, and false if neither the scoped nor the global key is set.
+func (s *ScopedConfig) Resolve(key string) (Resolved, bool) {
+	if k := s.scoped(key); s.parent.IsSet(k) {
+		return Resolved{Key: k, Scoped: true, Source: s.parent.Source(k)}, true
+	}
+	if k := s.global(key); s.parent.IsSet(k) {
+		return Resolved{Key: k, Source: s.parent.Source(k)}, true
+	}
+	return Resolved{}, false
+}
+
+// Get returns the scoped value for the key, the global value if not set, or nil.
+func (s *ScopedConfig) Get(key string) any {
+	scoped := s.parent.Get(s.scoped(key))
+	global := s.parent.Get(s.global(key))
+
+	scopedMap, ok1 := scoped.(map[string]any)
+	globalMap, ok2 := global.(map[string]any)
+	switch {
+	case ok1 && ok2:
+		return mergeMaps(globalMap, scopedMap)
+	case scoped != nil:
+		return scoped
+	default:
+		return global
+	}
+}
+
+// GetBool returns the value for the key as a boolean.
+func (s *ScopedConfig) GetBool(key string) bool {
+	return cast.ToBool(s.Get(key))
+}
+
+// GetInt returns the value for the key as an integer.
+func (s *ScopedConfig) GetInt(key string) int {
+	return cast.ToInt(s.Get(key))
+}
+
+// GetUint64 returns the value for the key as an unsigned integer.
+func (s *ScopedConfig) GetUint64(key string) uint64 {
+	return cast.ToUint64(s.Get(key))
+}
+
+// GetFloat64 returns the value for the key as a float64.
+func (s *ScopedConfig) GetFloat64(key string) float64 {
+	return cast.ToFloat64(s.Get(key))
+}
+
+// GetString returns the value for the key as a string.
+func (s *ScopedConfig) GetString(key string) string {
+	return cast.ToString(s.Get(key))
+}
+
+// GetStringSlice returns the value for the key as a slice of strings.
+func (s *ScopedConfig) GetStringSlice(key string) []string {
+	return cast.ToStringSlice(s.Get(key))
+}
+
+// GetDuration returns the value for the key as a duration.
+func (s *ScopedConfig) GetDuration(key string) time.Duration {
+	return cast.ToDuration(s.Get(key))
+}
+
+// GetBoolE returns the value for the key as a boolean.
+func (s *ScopedConfig) GetBoolE(key string) (bool, error) {
+	return s.typed().boolE(key)
+}
+
+// GetIntE returns the value for the key as an integer.
+func (s *ScopedConfig) GetIntE(key string) (int, error) {
+	return s.typed().intE(key)
+}
+
+// GetUint64E returns the value for the key as an unsigned integer.
+func (s *ScopedConfig) GetUint64E(key string) (uint64, error) {
+	return s.typed().uint64E(key)
+}
+
+// GetFloat64E returns the value for the key as a float64.
+func (s *ScopedConfig) GetFloat64E(key string) (float64, error) {
+	return s.typed().float64E(key)
+}
+
+// GetStringE returns the value for the key as a string.
+func (s *ScopedConfig) GetStringE(key string) (string, error) {
+	return s.typed().stringE(key)
+}
+
+// GetStringSliceE returns the value for the key as a slice of strings.
+func (s *ScopedConfig) GetStringSliceE(key string) ([]string, error) {
+	return s.typed().stringSliceE(key)
+}
+
+// GetDurationE returns the value for the key as a duration.
+func (s *ScopedConfig) GetDurationE(key string) (time.Duration, error) {
+	return s.typed().durationE(key)
+}
+
+// GetTimeE returns the value for the key as a time.
+func (s *ScopedConfig) GetTimeE(key string) (time.Time, error) {
+	return s.typed().timeE(key)
+}
+
+// GetStringMapE returns the value for the key as a map.
+func (s *ScopedConfig) GetStringMapE(key string) (map[string]any, error) {
+	return s.typed().stringMapE(key)
+}
+
+// GetStringMapStringE returns the value for the key as a map of strings.
+func (s *ScopedConfig) GetStringMapStringE(key string) (map[string]string, error) {
+	return s.typed().stringMapStringE(key)
+}
+
+// GetIntSliceE returns the value for the key as a slice of integers.
+func (s *ScopedConfig) GetIntSliceE(key string) ([]int, error) {
+	return s.typed().intSliceE(key)
+}
+
+// GetSizeInBytesE returns the value for the key as bytes, parsing sizes like "2GB".
+func (s *ScopedConfig) GetSizeInBytesE(key string) (uint64, error) {
+	return s.typed().sizeInBytesE(key)
+}
+
+// UnmarshalKey decodes the value for the key into out.
+func (s *ScopedConfig) UnmarshalKey(key string, out any) error {
+	return s.typed().unmarshalKey(key, out)
+}
+
+// Set sets an override value for the scoped key.
+func (s *ScopedConfig) Set(key string, value any) {
+	s.parent.Set(s.scoped(key), value)
+}
+
+// SetDefault sets the default value for the scoped key.
+func (s *ScopedConfig) SetDefault(key string, value any) {
+	s.parent.SetDefault(s.scoped(key), value)
+}
+
+// IsSet returns true if the scoped or global key has a value. Resolve reports which.
+func (s *ScopedConfig) IsSet(key string) bool {
+	_, ok := s.Resolve(key)
+	return ok
+}
+
+// Source returns where the resolved key's value came from.
+func (s *ScopedConfig) Source(key string) Source {
+	r, _ := s.Resolve(key)
+	return r.Source
+}
+
+// AllKeys returns the scoped keys and the global keys outside the scope, without prefixes.
+//
+// Keys of sibling scopes are skipped, e.g. channels.sports.output in a view of channels.news.
+func (s *ScopedConfig) AllKeys() []string {
+	var siblings string // Namespace holding the scope and its siblings.
+	if i := strings.LastIndexByte(s.prefix, '.'); i >= 0 {
+		siblings = s.prefix[:i]
+	}
+
+	seen := make(map[string]struct{})
+	var keys []string
+	add := func(k string) {
+		if _, ok := seen[k]; !ok {
+			seen[k] = struct{}{}
+			keys = append(keys, k)
+		}
+	}
+
+	for _, k := range s.parent.AllKeys() {
+		if rest, ok := strings.CutPrefix(k, s.prefix+"."); ok {
+			add(rest)
+			continue
+		}
+		if s.fallback == "" {
+			if siblings == "" || !related(siblings, k) {
+				add(k)
+			}
+		} else if rest, ok := strings.CutPrefix(k, s.fallback+"."); ok {
+			add(rest)
+		}
+	}
+	return keys
+}
+
+// Sub returns a scoped view under the key, or nil if neither the scoped nor the global key holds a map.
+func (s *ScopedConfig) Sub(key string) Config {
+	if _, ok := s.Get(key).(map[string]any); !ok {
+		return nil
+	}
+	return &ScopedConfig{parent: s.parent, prefix: s.scoped(key), fallback: s.global(key)}
+}
+
+// Unmarshal decodes all settings into the struct pointed to by out.
+func (s *ScopedConfig) Unmarshal(out any) error {
+	settings := make(map[string]any)
+	for _, k := range s.AllKeys() {
+		setNested(settings, k, s.Get(k))
+	}
+	return decode(settings, out)
+}
+
+// Watch calls onChange after the underlying config source changes.
+func (s *ScopedConfig) Watch(onChange func()) error {
+	return s.parent.Watch(onChange)
+}
+
+// **** Private **********************************************************************************
+
+// scoped returns the full scoped key.
+func (s *ScopedConfig) scoped(key string) string {
+	return joinKey(s.prefix, key)
+}
+
+// global returns the full global key.
+func (s *ScopedConfig) global(key string) string {
+	return joinKey(s.fallback, key)
+}
+
+// typed returns the error-returning getters.
+func (s *ScopedConfig) typed() typedGetters {
+	return typedGetters{get: s.Get, sub: s.Sub, source: s.Source}
+}
+
+// joinKey joins a prefix and key with a dot.
+func joinKey(prefix, key string) string {
+	if prefix == "" {
+		return key
+	}
+	return prefix + "." + key
+}
+
+// mergeMaps returns the nested maps merged, with values from over replacing those from base.
+func mergeMaps(base, over map[string]any) map[string]any {
+	flat, overFlat := make(map[string]any), make(map[string]any)
+	flattenInto(flat, "", base)
+	flattenInto(overFlat, "", over)
+
+	for k, v := range overFlat {
+		for b := range flat {
+			if related(b, k) {
+				delete(flat, b)
+			}
+		}
+		flat[k] = v
+	}
+
+	out := make(map[string]any)
+	for k, v := range flat {
+		setNested(out, k, v)
+	}
+	return out
+}
@@ -0,0 +1,318 @@
+package abstractions
+
+import (
+	"errors"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SnapshotConfig is a copy of a config's values and sources, e.g. for a job to use from start to
+// finish while the config is reloaded or changed.
+//
+// Set and SetDefault change only the snapshot, never the config it was taken from. Watch returns an
+// error.
+type SnapshotConfig struct {
+	m       *MemoryConfig     // Copied values, and values set on the snapshot.
+	sources map[string]Source // Sources of the copied values, never changed.
+}
+
+// NewSnapshot returns a copy of c.
+//
+// Built-in configs are copied under one lock, so the snapshot never mixes values from before and
+// after a concurrent change.
+func NewSnapshot(c Config) *SnapshotConfig {
+	if s, ok := c.(snapshotter); ok {
+		return s.snapshot()
+	}
+	return newSnapshot(c.AllKeys(), c.Get, c.Source)
+}
+
+// Snapshot returns a copy of the default config.
+func Snapshot() *SnapshotConfig {
+	return NewSnapshot(Default())
+}
+
+// Get returns the value for the key, or nil if not set.
+func (s *SnapshotConfig) Get(key string) any {
+	return s.m.Get(key)
+}
+
+// GetBool returns the value for the key as a boolean.
+func (s *SnapshotConfig) GetBool(key string) bool {
+	return s.m.GetBool(key)
+}
+
+// GetInt returns the value for the key as an integer.
+func (s *SnapshotConfig) GetInt(key string) int {
+	return s.m.GetInt(key)
+}
+
+// GetUint64 returns the value for the key as an unsigned integer.
+func (s *SnapshotConfig) GetUint64(key string) uint64 {
+	return s.m.GetUint64(key)
+}
+
+// GetFloat64 returns the value for the key as a float64.
+func (s *SnapshotConfig) GetFloat64(key string) float64 {
+	return s.m.GetFloat64(key)
+}
+
+// GetString returns the value for the key as a string.
+func (s *SnapshotConfig) GetString(key string) string {
+	return s.m.GetString(key)
+}
+
+// GetStringSlice returns the value for the key as a slice of strings.
+func (s *SnapshotConfig) GetStringSlice(key string) []string {
+	return s.m.GetStringSlice(key)
+}
+
+// GetDuration returns the value for the key as a duration.
+func (s *SnapshotConfig) GetDuration(key string) time.Duration {
+	return s.m.GetDuration(key)
+}
+
+// GetBoolE returns the value for the key as a boolean.
+func (s *SnapshotConfig) GetBoolE(key string) (bool, error) {
+	return s.typed().boolE(key)
+}
+
+// GetIntE returns the value for the key as an integer.
+func (s *SnapshotConfig) GetIntE(key string) (int, error) {
+	return s.typed().intE(key)
+}
+
+// GetUint64E returns the value for the key as an unsigned integer.
+func (s *SnapshotConfig) GetUint64E(key string) (uint64, error) {
+	return s.typed().uint64E(key)
+}
+
+// GetFloat64E returns the value for the key as a float64.
+func (s *SnapshotConfig) GetFloat64E(key string) (float64, error) {
+	return s.typed().float64E(key)
+}
+
+// GetStringE returns the value for the key as a string.
+func (s *SnapshotConfig) GetStringE(key string) (string, error) {
+	return s.typed().stringE(key)
+}
+
+// GetStringSliceE returns the value for the key as a slice of strings.
+func (s *SnapshotConfig) GetStringSliceE(key string) ([]string, error) {
+	return s.typed().stringSliceE(key)
+}
+
+// GetDurationE returns the value for the key as a duration.
+func (s *SnapshotConfig) GetDurationE(key string) (time.Duration, error) {
+	return s.typed().durationE(key)
+}
+
+// GetTimeE returns the value for the key as a time.
+func (s *SnapshotConfig) GetTimeE(key string) (time.Time, error) {
+	return s.typed().timeE(key)
+}
+
+// GetStringMapE returns the value for the key as a map.
+func (s *SnapshotConfig) GetStringMapE(key string) (map[string]any, error) {
+	return s.typed().stringMapE(key)
+}
+
+// GetStringMapStringE returns the value for the key as a map of strings.
+func (s *SnapshotConfig) GetStringMapStringE(key string) (map[string]string, error) {
+	return s.typed().stringMapStringE(key)
+}
+
+// GetIntSliceE returns the value for the key as a slice of integers.
+func (s *SnapshotConfig) GetIntSliceE(key string) ([]int, error) {
+	return s.typed().intSliceE(key)
+}
+
+// GetSizeInBytesE returns the value for the key as bytes, parsing sizes like "2GB".
+func (s *SnapshotConfig) GetSizeInBytesE(key string) (uint64, error) {
+	return s.typed().sizeInBytesE(key)
+}
+
+// UnmarshalKey decodes the value for the key into out.
+func (s *SnapshotConfig) UnmarshalKey(key string, out any) error {
+	return s.typed().unmarshalKey(key, out)
+}
+
+// Set sets an override value for the key in the snapshot only.
+func (s *SnapshotConfig) Set(key string, value any) {
+	s.m.Set(key, value)
+}
+
+// SetDefault sets the default value for the key in the snapshot only.
+func (s *SnapshotConfig) SetDefault(key string, value any) {
+	s.m.SetDefault(key, value)
+}
+
+// IsSet returns true if the key had a value in any source, including defaults.
+func (s *SnapshotConfig) IsSet(key string) bool {
+	return s.m.IsSet(key)
+}
+
+// Source returns where the key's value came from when the snapshot was taken, or override and
+// default for values set on the snapshot.
+//
+// For a key holding a map, this is the highest precedence source of the keys below it.
+func (s *SnapshotConfig) Source(key string) Source {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+	return s.source(key)
+}
+
+// AllKeys returns all keys holding a value, sorted.
+func (s *SnapshotConfig) AllKeys() []string {
+	return s.m.AllKeys()
+}
+
+// Sub returns the snapshot under the key, or nil if the key does not hold a map.
+func (s *SnapshotConfig) Sub(key string) Config {
+	sub, ok := s.m.Sub(key).(*MemoryConfig)
+	if !ok {
+		return nil
+	}
+
+	prefix := strings.ToLower(key) + "."
+	out := &SnapshotConfig{m: sub, sources: make(map[string]Source)}
+	for k, src := range s.sources {
+		if rest, ok := strings.CutPrefix(k, prefix); ok {
+			out.sources[rest] = src
+		}
+	}
+	return out
+}
+
+// Unmarshal decodes all settings into the struct pointed to by out.
+func (s *SnapshotConfig) Unmarshal(out any) error {
+	return s.m.Unmarshal(out)
+}
+
+// Watch returns an error, snapshots do not change.
+func (s *SnapshotConfig) Watch(func()) error {
+	return errors.New("config snapshot does not change")
+}
+
+// **** Private **********************************************************************************
+
+// snapshotter is implemented by configs which copy their values under their own lock.
+type snapshotter interface {
+	snapshot() *SnapshotConfig
+}
+
+// Snapshot implementations.
+var (
+	_ snapshotter = (*ViperConfig)(nil)
+	_ snapshotter = (*MemoryConfig)(nil)
+	_ snapshotter = (*ScopedConfig)(nil)
+	_ snapshotter = (*SnapshotConfig)(nil)
+)
+
+// snapshot returns the viper values under the read lock.
+func (c *ViperConfig) snapshot() *SnapshotConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return newSnapshot(c.allKeys(), c.get, c.source)
+}
+
+// snapshot returns the values under the read lock.
+func (c *MemoryConfig) snapshot() *SnapshotConfig {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return newSnapshot(c.allKeys(), c.get, c.source)
+}
+
+// snapshot returns the scope resolved over a snapshot of its parent.
+func (s *ScopedConfig) snapshot() *SnapshotConfig {
+	view := &ScopedConfig{parent: NewSnapshot(s.parent), prefix: s.prefix, fallback: s.fallback}
+	return newSnapshot(view.AllKeys(), view.Get, view.Source)
+}
+
+// snapshot returns a copy of the snapshot under the read lock.
+func (s *SnapshotConfig) snapshot() *SnapshotConfig {
+	s.m.mu.RLock()
+	defer s.m.mu.RUnlock()
+	return newSnapshot(s.m.allKeys(), s.m.get, s.source)
+}
+
+// source returns the key's source, the caller holds the read lock.
+func (s *SnapshotConfig) source(key string) Source {
+	// The copied values are in the file layer, so override and default are set on the snapshot.
+	switch src := s.m.source(key); src {
+	case SourceOverride, SourceDefault, SourceNone:
+		return src
+	}
+
+	key = strings.ToLower(key)
+	if src, ok := s.sources[key]; ok {
+		return src
+	}
+
+	best := SourceNone
+	for k, src := range s.sources {
+		if strings.HasPrefix(k, key+".") && (best == SourceNone || sourceRank(src) < sourceRank(best)) {
+			best = src
+		}
+	}
+	return best
+}
+
+// typed returns the error-returning getters.
+func (s *SnapshotConfig) typed() typedGetters {
+	return typedGetters{get: s.Get, sub: s.Sub, source: s.Source}
+}
+
+// newSnapshot copies the value and source of each key.
+func newSnapshot(keys []string, get func(string) any, source func(string) Source) *SnapshotConfig {
+	s := &SnapshotConfig{m: NewMemory(nil), sources: make(map[string]Source)}
+	for _, k := range keys {
+		v := get(k)
+		if v == nil {
+			continue
+		}
+
+		flat := make(map[string]any)
+		flattenInto(flat, strings.ToLower(k), v)
+		src := source(k)
+		for fk, fv := range flat {
+			s.m.values[fk] = cloneValue(fv)
+			s.sources[fk] = src
+		}
+	}
+	return s
+}
+
+// cloneValue copies slices and maps, so later changes to the source config do not show in a snapshot.
+func cloneValue(v any) any {
+	switch v := v.(type) {
+	case []any:
+		out := make([]any, len(v))
+		for i, e := range v {
+			out[i] = cloneValue(e)
+		}
+		return out
+	case []string:
+		return slices.Clone(v)
+	case []int:
+		return slices.Clone(v)
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, e := range v {
+			out[k] = cloneValue(e)
+		}
+		return out
+	case map[string]string:
+		return maps.Clone(v)
+	default:
+		return v
+	}
+}
+
+// sourceRank returns the precedence of a source, lowest first.
+func sourceRank(s Source) int {
+	return slices.Index([]Source{SourceOverride, SourceFlag, SourceEnv, SourceFile, SourceDefault, SourceUnknown}, s)
+}
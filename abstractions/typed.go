@@ -0,0 +1,279 @@
+package abstractions
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/TubarrApp/gocommon/sharedvalidation"
+	"github.com/spf13/cast"
+)
+
+// **** Private **********************************************************************************
+
+// typedGetters implements the error-returning getters over a config's Get, Sub and Source.
+//
+// Failures return a *KeyError wrapping ErrNotSet for unset keys, or ErrWrongType or ErrParse for
+// malformed values.
+type typedGetters struct {
+	get    func(key string) any
+	sub    func(key string) Config
+	source func(key string) Source
+}
+
+// boolE returns the value for the key as a boolean.
+func (g typedGetters) boolE(key string) (bool, error) {
+	return castValue(g, key, "bool", false, false, toBool)
+}
+
+// intE returns the value for the key as an integer.
+func (g typedGetters) intE(key string) (int, error) {
+	return castValue(g, key, "int", false, false, toInt)
+}
+
+// uint64E returns the value for the key as an unsigned integer.
+func (g typedGetters) uint64E(key string) (uint64, error) {
+	return castValue(g, key, "uint64", false, false, toUint64)
+}
+
+// float64E returns the value for the key as a float64.
+func (g typedGetters) float64E(key string) (float64, error) {
+	return castValue(g, key, "float64", false, false, toFloat64)
+}
+
+// stringE returns the value for the key as a string.
+func (g typedGetters) stringE(key string) (string, error) {
+	return castValue(g, key, "string", false, false, cast.ToStringE)
+}
+
+// stringSliceE returns the value for the key as a slice of strings.
+func (g typedGetters) stringSliceE(key string) ([]string, error) {
+	return castValue(g, key, "[]string", true, false, cast.ToStringSliceE)
+}
+
+// durationE returns the value for the key as a duration, which must have a unit.
+func (g typedGetters) durationE(key string) (time.Duration, error) {
+	return typedValue[time.Duration](g, key, TypeDuration)
+}
+
+// timeE returns the value for the key as a time, e.g. from an RFC 3339 string or Unix seconds.
+func (g typedGetters) timeE(key string) (time.Time, error) {
+	return castValue(g, key, "time", false, false, cast.ToTimeE)
+}
+
+// stringMapE returns the value for the key as a map.
+func (g typedGetters) stringMapE(key string) (map[string]any, error) {
+	return castValue(g, key, "map", false, true, cast.ToStringMapE)
+}
+
+// stringMapStringE returns the value for the key as a map of strings.
+func (g typedGetters) stringMapStringE(key string) (map[string]string, error) {
+	return castValue(g, key, "map of strings", false, true, cast.ToStringMapStringE)
+}
+
+// intSliceE returns the value for the key as a slice of integers.
+func (g typedGetters) intSliceE(key string) ([]int, error) {
+	return castValue(g, key, "[]int", true, false, toIntSlice)
+}
+
+// sizeInBytesE returns the value for the key as bytes, parsing sizes like "2GB".
+func (g typedGetters) sizeInBytesE(key string) (uint64, error) {
+	return typedValue[uint64](g, key, TypeSize)
+}
+
+// unmarshalKey decodes the value for the key into out.
+func (g typedGetters) unmarshalKey(key string, out any) error {
+	if sub := g.sub(key); sub != nil {
+		if err := sub.Unmarshal(out); err != nil {
+			return &KeyError{Key: key, Value: g.get(key), Source: g.source(key), Err: decodeError(out, err)}
+		}
+		return nil
+	}
+
+	v := g.get(key)
+	if v == nil {
+		return nil
+	}
+	if err := decode(v, out); err != nil {
+		return &KeyError{Key: key, Value: v, Source: g.source(key), Err: decodeError(out, err)}
+	}
+	return nil
+}
+
+// typedValue converts the value for the key to a schema type.
+func typedValue[T any](g typedGetters, key string, t Type) (T, error) {
+	var zero T
+	v := g.get(key)
+	if v == nil {
+		return zero, &KeyError{Key: key, Err: ErrNotSet}
+	}
+
+	out, err := convert(t, v)
+	if err != nil {
+		return zero, &KeyError{Key: key, Value: v, Source: g.source(key), Err: err}
+	}
+	return out.(T), nil
+}
+
+// castValue converts the value for the key with a cast function.
+func castValue[T any](g typedGetters, key, want string, wantSlice, wantMap bool, fn func(any) (T, error)) (T, error) {
+	var zero T
+	v := g.get(key)
+	if v == nil {
+		return zero, &KeyError{Key: key, Err: ErrNotSet}
+	}
+
+	out, err := fn(v)
+	if err != nil {
+		return zero, &KeyError{Key: key, Value: v, Source: g.source(key), Err: conversionError(v, want, wantSlice, wantMap, err)}
+	}
+	return out, nil
+}
+
+// toBool converts a boolean, or a string like "true" or "1".
+func toBool(v any) (bool, error) {
+	switch v := v.(type) {
+	case bool:
+		return v, nil
+	case string:
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			return false, fmt.Errorf("%w: expected bool: %w", ErrParse, err)
+		}
+		return b, nil
+	default:
+		return false, fmt.Errorf("%w: expected bool, got %T", ErrWrongType, v)
+	}
+}
+
+// toInt converts integers, whole floats (e.g. from JSON) and base 10 integer strings.
+func toInt(v any) (int, error) {
+	n, err := toInt64(v, "int")
+	if err != nil {
+		return 0, err
+	}
+	if n < math.MinInt || n > math.MaxInt {
+		return 0, fmt.Errorf("%w: expected int: %d is out of range", ErrParse, n)
+	}
+	return int(n), nil
+}
+
+// toInt64 converts integers, whole floats and base 10 integer strings, reporting errors as want.
+func toInt64(v any, want string) (int64, error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if rv.Uint() > math.MaxInt64 {
+			return 0, fmt.Errorf("%w: expected %s: %d is out of range", ErrParse, want, rv.Uint())
+		}
+		return int64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return 0, fmt.Errorf("%w: expected %s, got %T %v", ErrWrongType, want, v, v)
+		}
+		return int64(f), nil
+	case reflect.String:
+		n, err := strconv.ParseInt(strings.TrimSpace(rv.String()), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: expected %s: %w", ErrParse, want, err)
+		}
+		return n, nil
+	default:
+		return 0, fmt.Errorf("%w: expected %s, got %T", ErrWrongType, want, v)
+	}
+}
+
+// toUint64 converts non-negative integers, whole floats and base 10 integer strings.
+func toUint64(v any) (uint64, error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return rv.Uint(), nil
+	case reflect.String:
+		n, err := strconv.ParseUint(strings.TrimSpace(rv.String()), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: expected uint64: %w", ErrParse, err)
+		}
+		return n, nil
+	}
+
+	n, err := toInt64(v, "uint64")
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("%w: expected uint64: %d is negative", ErrParse, n)
+	}
+	return uint64(n), nil
+}
+
+// toFloat64 converts numbers and float strings.
+func toFloat64(v any) (float64, error) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	case reflect.String:
+		f, err := strconv.ParseFloat(strings.TrimSpace(rv.String()), 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: expected float64: %w", ErrParse, err)
+		}
+		return f, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), nil
+	default:
+		return 0, fmt.Errorf("%w: expected float64, got %T", ErrWrongType, v)
+	}
+}
+
+// toIntSlice converts a slice of integers, each element converted as by toInt.
+func toIntSlice(v any) ([]int, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, fmt.Errorf("%w: expected []int, got %T", ErrWrongType, v)
+	}
+
+	out := make([]int, rv.Len())
+	for i := range out {
+		n, err := toInt(rv.Index(i).Interface())
+		if err != nil {
+			return nil, fmt.Errorf("element %d: %w", i, err)
+		}
+		out[i] = n
+	}
+	return out, nil
+}
+
+// toSize converts a byte count or size string to bytes.
+func toSize(v any) (uint64, error) {
+	if s, ok := v.(string); ok {
+		return sharedvalidation.ParseByteSize(s)
+	}
+	return toUint64(v)
+}
+
+// toDuration converts a duration or a string with a unit, e.g. "30s".
+//
+// Numbers are rejected, viper would read them as nanoseconds.
+func toDuration(v any) (time.Duration, error) {
+	switch v := v.(type) {
+	case time.Duration:
+		return v, nil
+	case string:
+		d, err := time.ParseDuration(strings.TrimSpace(v))
+		if err != nil {
+			return 0, fmt.Errorf("%w: expected %s with a unit, e.g. \"30s\": %w", ErrParse, TypeDuration, err)
+		}
+		return d, nil
+	default:
+		return 0, fmt.Errorf("%w: expected %s with a unit, e.g. \"30s\", got %T", ErrWrongType, TypeDuration, v)
+	}
+}
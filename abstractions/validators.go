@@ -0,0 +1,103 @@
+package abstractions
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/TubarrApp/gocommon/sharederrors"
+	"github.com/TubarrApp/gocommon/sharedvalidation"
+)
+
+// Validator checks a value already converted to its key type, returning the normalized value.
+type Validator func(value any) (any, error)
+
+// StringValidator adapts a string validation function.
+func StringValidator(fn func(string) (string, error)) Validator {
+	return func(value any) (any, error) {
+		s, ok := value.(string)
+		if !ok {
+			return nil, typeError(value, TypeString)
+		}
+		return fn(s)
+	}
+}
+
+// IntNormalizer adapts an integer clamping function.
+func IntNormalizer(fn func(int) int) Validator {
+	return func(value any) (any, error) {
+		n, ok := value.(int)
+		if !ok {
+			return nil, typeError(value, TypeInt)
+		}
+		return fn(n), nil
+	}
+}
+
+// FloatNormalizer adapts a float clamping function.
+func FloatNormalizer(fn func(float64) float64) Validator {
+	return func(value any) (any, error) {
+		f, ok := value.(float64)
+		if !ok {
+			return nil, typeError(value, TypeFloat)
+		}
+		return fn(f), nil
+	}
+}
+
+// Validators for common keys, wrapping sharedvalidation.
+var (
+	ValidVideoCodec       = StringValidator(sharedvalidation.ValidateVideoCodec)
+	ValidAudioCodec       = StringValidator(sharedvalidation.ValidateAudioCodec)
+	ValidGPUAccelType     = StringValidator(sharedvalidation.ValidateGPUAccelType)
+	ValidTranscodeQuality = StringValidator(sharedvalidation.ValidateTranscodeQuality)
+	ValidTranscodePreset  = StringValidator(sharedvalidation.ValidateTranscodePreset)
+	ValidOutputExt        = StringValidator(sharedvalidation.ValidateFFmpegOutputExt)
+	ValidMinFreeMem       = StringValidator(sharedvalidation.ValidateMinFreeMem)
+	ValidConcurrencyLimit = IntNormalizer(sharedvalidation.ValidateConcurrencyLimit)
+)
+
+// ValidMaxCPU returns a validator clamping a max CPU percentage.
+func ValidMaxCPU(allowZero bool) Validator {
+	return FloatNormalizer(func(f float64) float64 {
+		return sharedvalidation.ValidateMaxCPU(f, allowZero)
+	})
+}
+
+// ValidDirectory returns a validator checking a directory exists, creating it if requested.
+//
+// Templated directories are only checked for valid tags. A missing directory is created by the
+// schema once every key is valid, so a rejected config creates nothing.
+func ValidDirectory(createIfNotFound bool, templateMap map[string]struct{}) Validator {
+	return func(value any) (any, error) {
+		dir, ok := value.(string)
+		if !ok {
+			return nil, typeError(value, TypeString)
+		}
+
+		_, _, err := sharedvalidation.ValidateDirectory(dir, false, templateMap)
+		switch {
+		case err == nil:
+			return dir, nil
+		case createIfNotFound && errors.Is(err, sharederrors.ErrPathNotFound):
+			return deferred{value: dir, prepare: func() error {
+				_, _, err := sharedvalidation.ValidateDirectory(dir, true, templateMap)
+				return err
+			}}, nil
+		default:
+			return nil, err
+		}
+	}
+}
+
+// **** Private **********************************************************************************
+
+// deferred is a valid value with a side effect, run by the schema once every key is valid.
+type deferred struct {
+	value   any
+	prepare func() error
+}
+
+// typeError reports a value of the wrong type passed to a validator.
+func typeError(value any, want Type) error {
+	return fmt.Errorf("%w: expected %s, got %T", ErrWrongType, want, value)
+}
@@ -1,54 +1,532 @@
-// Package abstractions provides a layer to interact with functions like Viper. Allows for future swapping out if required.
 package abstractions
 
-import "github.com/spf13/viper"
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	"unsafe"
 
-// Set sets the value for the key in the override register. Set is case-insensitive for a key.
-// Will be used instead of values obtained via flags, config file, ENV, default, or key/value store.
-func Set(key string, value any) {
-	viper.Set(key, value)
+	"github.com/fsnotify/fsnotify"
+	"github.com/spf13/cast"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// ViperConfig is a Config backed by a viper instance.
+//
+// It is safe for concurrent use, as long as the viper instance is only changed through the ViperConfig.
+type ViperConfig struct {
+	mu sync.RWMutex // Guards viper, which is not safe for concurrent Set and Get.
+	v  *viper.Viper // Nil for the global instance.
+
+	src         viperSources
+	filesLoaded bool // File values were loaded by a FileLoader, not read from viper's config file.
+
+	watchMu  sync.Mutex
+	watcher  *fsnotify.Watcher
+	watchers []func()
+}
+
+// NewViper returns a Config backed by v, or by the global viper instance if v is nil.
+//
+// Flags, environment bindings and config files set up directly on v are visible through the Config.
+func NewViper(v *viper.Viper) *ViperConfig {
+	return &ViperConfig{v: v}
+}
+
+// Viper returns the underlying viper instance.
+//
+// Changes made directly on the instance are not synchronized with the ViperConfig, make them before
+// concurrent use begins.
+func (c *ViperConfig) Viper() *viper.Viper {
+	if c.v == nil {
+		return viper.GetViper() // Replaced by viper.Reset.
+	}
+	return c.v
+}
+
+// Get returns the value for the key, or nil if not set.
+func (c *ViperConfig) Get(key string) any {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.get(key)
+}
+
+// GetBool returns the value for the key as a boolean.
+func (c *ViperConfig) GetBool(key string) bool {
+	return cast.ToBool(c.Get(key))
+}
+
+// GetInt returns the value for the key as an integer.
+func (c *ViperConfig) GetInt(key string) int {
+	return cast.ToInt(c.Get(key))
+}
+
+// GetUint64 returns the value for the key as an unsigned integer.
+func (c *ViperConfig) GetUint64(key string) uint64 {
+	return cast.ToUint64(c.Get(key))
+}
+
+// GetFloat64 returns the value for the key as a float64.
+func (c *ViperConfig) GetFloat64(key string) float64 {
+	return cast.ToFloat64(c.Get(key))
+}
+
+// GetString returns the value for the key as a string.
+func (c *ViperConfig) GetString(key string) string {
+	return cast.ToString(c.Get(key))
+}
+
+// GetStringSlice returns the value for the key as a slice of strings.
+func (c *ViperConfig) GetStringSlice(key string) []string {
+	return cast.ToStringSlice(c.Get(key))
+}
+
+// GetDuration returns the value for the key as a duration.
+func (c *ViperConfig) GetDuration(key string) time.Duration {
+	return cast.ToDuration(c.Get(key))
+}
+
+// GetBoolE returns the value for the key as a boolean.
+func (c *ViperConfig) GetBoolE(key string) (bool, error) {
+	return c.typed().boolE(key)
+}
+
+// GetIntE returns the value for the key as an integer.
+func (c *ViperConfig) GetIntE(key string) (int, error) {
+	return c.typed().intE(key)
 }
 
-// Get can retrieve any value given the key to use. Get is case-insensitive for a key.
-// Get has the behavior of returning the value associated with the first place from where it is set.
-// Viper will check in the following order: override, flag, env, config file, key/value store, default.
-// Get returns an interface. For a specific value use one of the Get____ methods.
-func Get(key string) any {
-	return viper.Get(key)
+// GetUint64E returns the value for the key as an unsigned integer.
+func (c *ViperConfig) GetUint64E(key string) (uint64, error) {
+	return c.typed().uint64E(key)
 }
 
-// GetBool returns the value associated with the key as a boolean.
-func GetBool(key string) bool {
-	return viper.GetBool(key)
+// GetFloat64E returns the value for the key as a float64.
+func (c *ViperConfig) GetFloat64E(key string) (float64, error) {
+	return c.typed().float64E(key)
 }
 
-// GetInt returns the value associated with the key as an integer.
-func GetInt(key string) int {
-	return viper.GetInt(key)
+// GetStringE returns the value for the key as a string.
+func (c *ViperConfig) GetStringE(key string) (string, error) {
+	return c.typed().stringE(key)
 }
 
-// GetUint64 returns the value associated with the key as an unsigned integer.
-func GetUint64(key string) uint64 {
-	return viper.GetUint64(key)
+// GetStringSliceE returns the value for the key as a slice of strings.
+func (c *ViperConfig) GetStringSliceE(key string) ([]string, error) {
+	return c.typed().stringSliceE(key)
 }
 
-// GetFloat64 returns the value associated with the key as a float64.
-func GetFloat64(key string) float64 {
-	return viper.GetFloat64(key)
+// GetDurationE returns the value for the key as a duration.
+func (c *ViperConfig) GetDurationE(key string) (time.Duration, error) {
+	return c.typed().durationE(key)
 }
 
-// GetString returns the value associated with the key as a string.
-func GetString(key string) string {
-	return viper.GetString(key)
+// GetTimeE returns the value for the key as a time.
+func (c *ViperConfig) GetTimeE(key string) (time.Time, error) {
+	return c.typed().timeE(key)
 }
 
-// GetStringSlice returns the value associated with the key as a slice of strings.
-func GetStringSlice(key string) []string {
-	return viper.GetStringSlice(key)
+// GetStringMapE returns the value for the key as a map.
+func (c *ViperConfig) GetStringMapE(key string) (map[string]any, error) {
+	return c.typed().stringMapE(key)
+}
+
+// GetStringMapStringE returns the value for the key as a map of strings.
+func (c *ViperConfig) GetStringMapStringE(key string) (map[string]string, error) {
+	return c.typed().stringMapStringE(key)
+}
+
+// GetIntSliceE returns the value for the key as a slice of integers.
+func (c *ViperConfig) GetIntSliceE(key string) ([]int, error) {
+	return c.typed().intSliceE(key)
+}
+
+// GetSizeInBytesE returns the value for the key as bytes, parsing sizes like "2GB".
+func (c *ViperConfig) GetSizeInBytesE(key string) (uint64, error) {
+	return c.typed().sizeInBytesE(key)
+}
+
+// UnmarshalKey decodes the value for the key into out.
+func (c *ViperConfig) UnmarshalKey(key string, out any) error {
+	return c.typed().unmarshalKey(key, out)
+}
+
+// Set sets an override value for the key.
+func (c *ViperConfig) Set(key string, value any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.Viper().Set(key, value)
+	c.src.add(&c.src.overrides, key)
+}
+
+// SetDefault sets the default value for the key.
+func (c *ViperConfig) SetDefault(key string, value any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.Viper().SetDefault(key, value)
+	c.src.add(&c.src.defaults, key)
+}
+
+// BindFlag binds a command-line flag to the key. The flag value is used if the flag was changed.
+func (c *ViperConfig) BindFlag(key string, flag *pflag.Flag) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.Viper().BindPFlag(key, flag); err != nil {
+		return err
+	}
+
+	c.src.mu.Lock()
+	defer c.src.mu.Unlock()
+	if c.src.flags == nil {
+		c.src.flags = make(map[string]*pflag.Flag)
+	}
+	c.src.flags[strings.ToLower(key)] = flag
+	return nil
+}
+
+// Source returns where the key's value came from.
+//
+// Overrides, defaults, flags and environment variables are known when set through the ViperConfig. Values set on the viper
+// instance directly report SourceUnknown, except config file values.
+func (c *ViperConfig) Source(key string) Source {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.source(key)
+}
+
+// IsSet returns true if the key has a value in any source, including defaults.
+func (c *ViperConfig) IsSet(key string) bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.get(key) != nil || c.Viper().IsSet(key)
+}
+
+// AllKeys returns all keys holding a value.
+func (c *ViperConfig) AllKeys() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.allKeys()
+}
+
+// Sub returns a copy of the config under the key, or nil if the key does not hold a map.
+func (c *ViperConfig) Sub(key string) Config {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	sub := c.Viper().Sub(key)
+	if sub == nil {
+		return nil
+	}
+	out := &ViperConfig{v: sub}
+	c.src.copySub(key, &out.src)
+	return out
+}
+
+// Unmarshal decodes all settings into the struct pointed to by out.
+func (c *ViperConfig) Unmarshal(out any) error {
+	c.mu.RLock()
+	settings := c.Viper().AllSettings()
+	c.mu.RUnlock()
+
+	return decode(settings, out)
+}
+
+// Watch watches the config file in use, calling onChange after it is edited and re-read.
+//
+// Files loaded by a FileLoader are watched by a Reloader (NewReloader or WatchFiles) instead, and
+// onChange is called after each reload it applies. Call Close to stop watching.
+func (c *ViperConfig) Watch(onChange func()) error {
+	c.mu.RLock()
+	file := c.Viper().ConfigFileUsed()
+	filesLoaded := c.filesLoaded
+	c.mu.RUnlock()
+
+	c.watchMu.Lock()
+	defer c.watchMu.Unlock()
+
+	if filesLoaded {
+		c.watchers = append(c.watchers, onChange)
+		return nil
+	}
+	if file == "" {
+		return errors.New("no config file loaded to watch")
+	}
+
+	// Start the watcher once, dispatching to every registered function.
+	if c.watcher == nil {
+		w, err := fsnotify.NewWatcher()
+		if err != nil {
+			return err
+		}
+		if err := w.Add(filepath.Dir(file)); err != nil {
+			w.Close()
+			return err
+		}
+		c.watcher = w
+		go c.watchFile(w, file)
+	}
+	c.watchers = append(c.watchers, onChange)
+	return nil
+}
+
+// Close stops watching the config file and removes the functions registered with Watch.
+func (c *ViperConfig) Close() error {
+	c.watchMu.Lock()
+	defer c.watchMu.Unlock()
+
+	c.watchers = nil
+	if c.watcher == nil {
+		return nil
+	}
+	err := c.watcher.Close()
+	c.watcher = nil
+	return err
+}
+
+// **** Private **********************************************************************************
+
+// get returns the value for the key, the caller holds mu.
+func (c *ViperConfig) get(key string) any {
+	return c.Viper().Get(key)
+}
+
+// source returns where the key's value came from, the caller holds mu.
+func (c *ViperConfig) source(key string) Source {
+	if c.Viper().Get(key) == nil {
+		return SourceNone
+	}
+
+	key = strings.ToLower(key)
+	switch {
+	case c.src.has(c.src.overrides, key):
+		return SourceOverride
+	case c.src.flagChanged(key):
+		return SourceFlag
+	case c.src.envPresent(key):
+		return SourceEnv
+	case c.Viper().InConfig(key):
+		return SourceFile
+	case c.src.has(c.src.defaults, key), !c.Viper().IsSet(key): // Unchanged flags are defaults.
+		return SourceDefault
+	default:
+		return SourceUnknown
+	}
+}
+
+// allKeys returns all keys holding a value, the caller holds mu.
+func (c *ViperConfig) allKeys() []string {
+	return c.Viper().AllKeys()
+}
+
+// typed returns the error-returning getters.
+func (c *ViperConfig) typed() typedGetters {
+	return typedGetters{get: c.Get, sub: c.Sub, source: c.Source}
+}
+
+// bindEnv binds environment variables to the key.
+func (c *ViperConfig) bindEnv(key string, names ...string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.Viper().BindEnv(append([]string{key}, names...)...); err != nil {
+		return err
+	}
+
+	c.src.mu.Lock()
+	defer c.src.mu.Unlock()
+	if c.src.envs == nil {
+		c.src.envs = make(map[string][]string)
+	}
+	c.src.envs[strings.ToLower(key)] = names
+	return nil
+}
+
+// loadFiles replaces viper's config file values with the layered values from a FileLoader, then calls the watchers.
+func (c *ViperConfig) loadFiles(values map[string]any) error {
+	c.mu.Lock()
+	v := c.Viper()
+	err := clearConfig(v)
+	if err == nil {
+		err = v.MergeConfigMap(values)
+	}
+	c.filesLoaded = true
+	c.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	c.watchMu.Lock()
+	watchers := slices.Clone(c.watchers)
+	c.watchMu.Unlock()
+	for _, fn := range watchers {
+		fn()
+	}
+	return nil
+}
+
+// clearConfig removes viper's config file values by reading an empty document, keeping the
+// caller's config type.
+//
+// Reading needs a config type and viper cannot unset one, so the unexported field is restored.
+func clearConfig(v *viper.Viper) error {
+	field := reflect.ValueOf(v).Elem().FieldByName("configType")
+	if field.Kind() != reflect.String {
+		return errors.New("cannot clear viper config values: unsupported viper version")
+	}
+	configType := reflect.NewAt(field.Type(), unsafe.Pointer(field.UnsafeAddr())).Elem()
+
+	saved := configType.String()
+	defer configType.SetString(saved)
+	configType.SetString("json")
+	return v.ReadConfig(strings.NewReader("{}"))
+}
+
+// watchFile re-reads the config file after it changes, then calls the watchers.
+//
+// This replaces viper's WatchConfig, which re-reads the file without holding mu.
+func (c *ViperConfig) watchFile(w *fsnotify.Watcher, file string) {
+	for {
+		select {
+		case ev, ok := <-w.Events:
+			if !ok {
+				return
+			}
+			if filepath.Clean(ev.Name) != filepath.Clean(file) || !ev.Has(fsnotify.Write|fsnotify.Create) {
+				continue
+			}
+
+			c.mu.Lock()
+			err := c.Viper().ReadInConfig()
+			c.mu.Unlock()
+			if err != nil {
+				continue // Keep the previous values, e.g. while the file is half written.
+			}
+
+			c.watchMu.Lock()
+			watchers := slices.Clone(c.watchers)
+			c.watchMu.Unlock()
+			for _, fn := range watchers {
+				fn()
+			}
+		case _, ok := <-w.Errors:
+			if !ok {
+				return
+			}
+		}
+	}
+}
+
+// viperSources tracks value sources viper does not expose.
+type viperSources struct {
+	mu        sync.RWMutex
+	overrides map[string]struct{}
+	defaults  map[string]struct{}
+	flags     map[string]*pflag.Flag
+	envs      map[string][]string // Bound environment variable names.
+}
+
+// add records a key in one of the sets.
+func (s *viperSources) add(set *map[string]struct{}, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if *set == nil {
+		*set = make(map[string]struct{})
+	}
+	(*set)[strings.ToLower(key)] = struct{}{}
+}
+
+// has returns true if the set holds the key, a parent of it or a key nested below it.
+//
+// The empty key covers everything (a Sub of a recorded key).
+func (s *viperSources) has(set map[string]struct{}, key string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for k := range set {
+		if related(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// flagChanged returns true if a flag bound to the key (or a parent) was set on the command line.
+func (s *viperSources) flagChanged(key string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for k, f := range s.flags {
+		if f.Changed && related(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+// envPresent returns true if an environment variable bound to the key (or a parent) is set.
+//
+// Empty variables are ignored, as viper does by default.
+func (s *viperSources) envPresent(key string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for k, names := range s.envs {
+		if related(k, key) && lookupEnv(names) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// copySub copies the tracked sources below prefix into out, with the prefix removed.
+func (s *viperSources) copySub(prefix string, out *viperSources) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	prefix = strings.ToLower(prefix)
+	subKey := func(k string) (string, bool) {
+		if k == prefix || strings.HasPrefix(prefix, k+".") {
+			return "", true // Covers the whole sub tree.
+		}
+		return strings.CutPrefix(k, prefix+".")
+	}
+
+	out.overrides = make(map[string]struct{})
+	out.defaults = make(map[string]struct{})
+	out.flags = make(map[string]*pflag.Flag)
+	out.envs = make(map[string][]string)
+	for k := range s.overrides {
+		if rest, ok := subKey(k); ok {
+			out.overrides[rest] = struct{}{}
+		}
+	}
+	for k := range s.defaults {
+		if rest, ok := subKey(k); ok {
+			out.defaults[rest] = struct{}{}
+		}
+	}
+	for k, f := range s.flags {
+		if rest, ok := subKey(k); ok {
+			out.flags[rest] = f
+		}
+	}
+	for k, names := range s.envs {
+		if rest, ok := subKey(k); ok {
+			out.envs[rest] = names
+		}
+	}
 }
 
-// IsSet checks to see if the key has been set in any of the data locations.
-// IsSet is case-insensitive for a key.
-func IsSet(key string) bool {
-	return viper.IsSet(key)
+// related returns true if a and b are the same key, or one is nested below the other.
+func related(a, b string) bool {
+	return a == "" || a == b || strings.HasPrefix(b, a+".") || strings.HasPrefix(a, b+".")
 }
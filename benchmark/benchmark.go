@@ -4,108 +4,29 @@
 package benchmark
 
 import (
-	"fmt"
-	"os"
-	"path/filepath"
-	"runtime"
-	"runtime/pprof"
-	"runtime/trace"
-	"time"
-
 	"github.com/TubarrApp/gocommon/logging"
-	"github.com/TubarrApp/gocommon/sharedconsts"
 )
 
 // BenchFiles contain benchmarking files written on a benchmark-enabled run.
 type BenchFiles struct {
-	cpuFile   *os.File
-	memFile   *os.File
-	traceFile *os.File
+	*Session
 }
 
-var (
-	cpuProfPath,
-	memProfPath,
-	traceOutPath string
-)
-
 // SetupBenchmarking sets up and initiates benchmarking for a program run.
+//
+// Collects the default profiles into a timestamped subdirectory of benchmarkDir.
+// Profiles are finalized if a panic handled by the logger's Recover ends the program.
+// Use SetupFromConfig or NewSession to also finalize on SIGINT or SIGTERM.
 func SetupBenchmarking(log *logging.ProgramLogger, benchmarkDir string) (*BenchFiles, error) {
-	var err error
-	b := new(BenchFiles)
-
-	startTime := time.Now().Format("2006-01-02_15-04-05")
-	makeBenchFilepaths(log, benchmarkDir, startTime)
-
-	log.I("(Benchmarking this run. Start time: %s)", startTime)
-
-	// CPU profile
-	b.cpuFile, err = os.Create(cpuProfPath)
-	if err != nil {
-		CloseBenchFiles(log, b, "", fmt.Errorf("could not create CPU profiling file: %w", err))
-		return nil, err
-	}
-
-	if err := pprof.StartCPUProfile(b.cpuFile); err != nil {
-		CloseBenchFiles(log, b, "", fmt.Errorf("could not start CPU profiling: %w", err))
-		return nil, err
-	}
-
-	// Memory profile
-	b.memFile, err = os.Create(memProfPath)
-	if err != nil {
-		CloseBenchFiles(log, b, "", fmt.Errorf("could not create memory profiling file: %w", err))
-		return nil, err
-	}
-
-	// Trace
-	b.traceFile, err = os.Create(traceOutPath)
-	if err != nil {
-		CloseBenchFiles(log, b, "", fmt.Errorf("could not create trace file: %w", err))
-		return nil, err
-	}
-	if err := trace.Start(b.traceFile); err != nil {
-		CloseBenchFiles(log, b, "", fmt.Errorf("could not start trace: %w", err))
-		return nil, err
-	}
-
-	return b, nil
+	return setupSession(log, Options{Dir: benchmarkDir, HandlePanics: true})
 }
 
 // CloseBenchFiles closes bench files on program termination.
 func CloseBenchFiles(log *logging.ProgramLogger, b *BenchFiles, noErrExit string, setupErr error) {
-	if b == nil {
-		return
-	}
-
-	if b.cpuFile != nil {
-		log.I("Stopping CPU profile...")
-		pprof.StopCPUProfile()
-		if err := b.cpuFile.Close(); err != nil {
-			log.E("Failed to close file %q: %v", b.cpuFile.Name(), err)
-		}
-		b.cpuFile = nil // Prevent double-close
-	}
-
-	if b.traceFile != nil {
-		log.I("Stopping trace...")
-		trace.Stop()
-		if err := b.traceFile.Close(); err != nil {
-			log.E("Failed to close file %q: %v", b.traceFile.Name(), err)
-		}
-		b.traceFile = nil // Prevent double-close
-	}
-
-	if b.memFile != nil {
-		log.I("Writing memory profile...")
-		runtime.GC()
-		if err := pprof.WriteHeapProfile(b.memFile); err != nil {
-			log.E("Could not write memory profile: %v", err)
-		}
-		if err := b.memFile.Close(); err != nil {
-			log.E("Failed to close file %q: %v", b.memFile.Name(), err)
+	if b != nil && b.Session != nil {
+		if err := b.Stop(); err != nil {
+			log.E("Failed to finalize benchmark files: %v", err)
 		}
-		b.memFile = nil // Prevent double-close
 	}
 
 	if setupErr != nil {
@@ -116,20 +37,20 @@ func CloseBenchFiles(log *logging.ProgramLogger, b *BenchFiles, noErrExit string
 	}
 }
 
-// makeBenchFilepaths makes paths for benchmarking files in a timestamped subdirectory.
-func makeBenchFilepaths(log *logging.ProgramLogger, baseDir, timestamp string) {
-	runDir := filepath.Join(baseDir, timestamp)
+// **** Private **********************************************************************************
 
-	// Create directory with perms.
-	if err := os.MkdirAll(runDir, sharedconsts.PermsGenericDir); err != nil {
-		log.E("Failed to create benchmark run directory: %v", err)
-		return
+// setupSession creates and starts a session with the given options.
+func setupSession(log *logging.ProgramLogger, opts Options) (*BenchFiles, error) {
+	s, err := NewSession(log, opts)
+	if err != nil {
+		log.E("Benchmarking failure: %v", err)
+		return nil, err
 	}
 
-	// Create filenames.
-	cpuProfPath = filepath.Join(runDir, "cpu.prof")
-	memProfPath = filepath.Join(runDir, "mem.prof")
-	traceOutPath = filepath.Join(runDir, "trace.out")
+	if err := s.Start(); err != nil {
+		log.E("Benchmarking failure: %v", err)
+		return nil, err
+	}
 
-	log.I("Created benchmark directory: %q", runDir)
+	return &BenchFiles{Session: s}, nil
 }
@@ -0,0 +1,730 @@
+package benchmark
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TubarrApp/gocommon/abstractions"
+	"github.com/TubarrApp/gocommon/logging/loggingtest"
+)
+
+// readManifest reads the manifest from a run directory.
+func readManifest(t *testing.T, runDir string) Manifest {
+	t.Helper()
+
+	data, err := os.ReadFile(filepath.Join(runDir, manifestFile))
+	if err != nil {
+		t.Fatalf("read manifest: %v", err)
+	}
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatalf("decode manifest: %v", err)
+	}
+	return m
+}
+
+func TestSession(t *testing.T) {
+	tl := loggingtest.NewTestLogger(t)
+	dir := t.TempDir()
+
+	s, err := NewSession(tl.ProgramLogger, Options{Dir: dir, Name: "test"})
+	if err != nil {
+		t.Fatalf("new session: %v", err)
+	}
+	if err := s.Stop(); !errors.Is(err, ErrSessionState) {
+		t.Errorf("expected state error stopping unstarted session, got %v", err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if err := s.Stop(); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if err := s.Stop(); err != nil {
+		t.Errorf("expected second stop to be a no-op, got %v", err)
+	}
+
+	m := readManifest(t, s.RunDir())
+	if len(m.Files) != len(DefaultProfiles) || m.Stopped.IsZero() {
+		t.Fatalf("unexpected manifest: %+v", m)
+	}
+	for _, f := range m.Files {
+		if info, err := os.Stat(filepath.Join(s.RunDir(), f.Path)); err != nil || info.Size() == 0 {
+			t.Errorf("expected non-empty %s profile at %q", f.Profile, f.Path)
+		}
+	}
+}
+
+func TestSessionErrors(t *testing.T) {
+	tl := loggingtest.NewTestLogger(t)
+
+	if _, err := NewSession(tl.ProgramLogger, Options{}); err == nil {
+		t.Errorf("expected error for missing directory")
+	}
+	if _, err := NewSession(tl.ProgramLogger, Options{Dir: t.TempDir(), Profiles: []Profile{"bogus"}}); err == nil {
+		t.Errorf("expected error for invalid profile")
+	}
+
+	// Base directory path is a file.
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	s, err := NewSession(tl.ProgramLogger, Options{Dir: file})
+	if err != nil {
+		t.Fatalf("new session: %v", err)
+	}
+	if err := s.Start(); err == nil {
+		t.Errorf("expected error creating run directory under a file")
+	}
+}
+
+func TestSessionExtraProfiles(t *testing.T) {
+	tl := loggingtest.NewTestLogger(t)
+
+	prevMemRate, prevMutex := runtime.MemProfileRate, runtime.SetMutexProfileFraction(-1)
+
+	profiles := []Profile{ProfileBlock, ProfileMutex, ProfileGoroutine, ProfileThreadCreate, ProfileAllocs}
+	s, err := NewSession(tl.ProgramLogger, Options{Dir: t.TempDir(), Profiles: profiles, MemProfileRate: 1024})
+	if err != nil {
+		t.Fatalf("new session: %v", err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if runtime.MemProfileRate != 1024 {
+		t.Errorf("expected session memory profile rate, got %d", runtime.MemProfileRate)
+	}
+	if err := s.Stop(); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+
+	// Runtime rates are restored.
+	if runtime.MemProfileRate != prevMemRate || runtime.SetMutexProfileFraction(-1) != prevMutex {
+		t.Errorf("expected rates restored to %d and %d, got %d and %d",
+			prevMemRate, prevMutex, runtime.MemProfileRate, runtime.SetMutexProfileFraction(-1))
+	}
+
+	// Block profile rates set by overlapping sessions are restored.
+	outer, err := NewSession(tl.ProgramLogger, Options{Dir: t.TempDir(), Profiles: []Profile{ProfileBlock}, BlockProfileRate: 5})
+	if err != nil {
+		t.Fatalf("new session: %v", err)
+	}
+	if err := outer.Start(); err != nil {
+		t.Fatalf("start outer: %v", err)
+	}
+	inner, err := NewSession(tl.ProgramLogger, Options{Dir: t.TempDir(), Profiles: []Profile{ProfileBlock}})
+	if err != nil {
+		t.Fatalf("new session: %v", err)
+	}
+	if err := inner.Start(); err != nil {
+		t.Fatalf("start inner: %v", err)
+	}
+	if err := inner.Stop(); err != nil {
+		t.Fatalf("stop inner: %v", err)
+	}
+	if blockRate != 5 {
+		t.Errorf("expected outer block profile rate restored, got %d", blockRate)
+	}
+	if err := outer.Stop(); err != nil {
+		t.Fatalf("stop outer: %v", err)
+	}
+	if blockRate != 0 {
+		t.Errorf("expected block profile rate reset, got %d", blockRate)
+	}
+
+	m := readManifest(t, s.RunDir())
+	if m.BlockProfileRate != DefaultBlockProfileRate || m.MutexProfileFraction != DefaultMutexProfileFraction {
+		t.Errorf("expected default rates in manifest, got %+v", m)
+	}
+	for _, p := range profiles {
+		if _, err := os.Stat(filepath.Join(s.RunDir(), profileFiles[p])); err != nil {
+			t.Errorf("expected %s profile: %v", p, err)
+		}
+	}
+}
+
+func TestWindowController(t *testing.T) {
+	tl := loggingtest.NewTestLogger(t)
+
+	c, err := NewWindowController(tl.ProgramLogger, Options{Dir: t.TempDir(), Profiles: []Profile{ProfileHeap, ProfileGoroutine}})
+	if err != nil {
+		t.Fatalf("new window controller: %v", err)
+	}
+	srv := httptest.NewServer(c.Handler(true))
+	defer srv.Close()
+
+	post := func(path string) int {
+		resp, err := http.Post(srv.URL+path, "", nil)
+		if err != nil {
+			t.Fatalf("post %s: %v", path, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := post("/benchmark/window/start?seconds=60"); code != http.StatusAccepted {
+		t.Fatalf("expected window start, got status %d", code)
+	}
+	runDir := c.Status().RunDir
+	if code := post("/benchmark/window/start"); code != http.StatusConflict {
+		t.Errorf("expected conflict starting second window, got status %d", code)
+	}
+	if code := post("/benchmark/window/stop"); code != http.StatusOK {
+		t.Fatalf("expected window stop, got status %d", code)
+	}
+	if c.Status().Active {
+		t.Errorf("expected no active window")
+	}
+	if code := post("/benchmark/window/stop"); code != http.StatusConflict {
+		t.Errorf("expected conflict stopping without a window, got status %d", code)
+	}
+	if m := readManifest(t, runDir); len(m.Files) != 2 {
+		t.Errorf("unexpected manifest: %+v", m)
+	}
+
+	resp, err := http.Get(srv.URL + "/debug/pprof/")
+	if err != nil {
+		t.Fatalf("get pprof index: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected pprof index, got status %d", resp.StatusCode)
+	}
+
+	// Failures other than the window state are server errors.
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0o644); err != nil {
+		t.Fatalf("write file: %v", err)
+	}
+	broken, err := NewWindowController(tl.ProgramLogger, Options{Dir: filepath.Join(file, "bench"), Profiles: []Profile{ProfileHeap}})
+	if err != nil {
+		t.Fatalf("new window controller: %v", err)
+	}
+	brokenSrv := httptest.NewServer(broken.Handler(false))
+	defer brokenSrv.Close()
+	resp, err = http.Post(brokenSrv.URL+"/benchmark/window/start", "", nil)
+	if err != nil {
+		t.Fatalf("post start: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusInternalServerError {
+		t.Errorf("expected server error for an unusable directory, got status %d", resp.StatusCode)
+	}
+
+	// Windows cannot collect a CPU profile while another session does.
+	main, err := NewSession(tl.ProgramLogger, Options{Dir: t.TempDir(), Profiles: []Profile{ProfileCPU}})
+	if err != nil {
+		t.Fatalf("new session: %v", err)
+	}
+	if err := main.Start(); err != nil {
+		t.Fatalf("start main session: %v", err)
+	}
+	defer main.Stop()
+
+	windowDir := t.TempDir()
+	cpu, err := NewWindowController(tl.ProgramLogger, Options{Dir: windowDir, Profiles: []Profile{ProfileCPU}})
+	if err != nil {
+		t.Fatalf("new window controller: %v", err)
+	}
+	cpuSrv := httptest.NewServer(cpu.Handler(false))
+	defer cpuSrv.Close()
+	resp, err = http.Post(cpuSrv.URL+"/benchmark/window/start", "", nil)
+	if err != nil {
+		t.Fatalf("post start: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Errorf("expected conflict with the main session's CPU profile, got status %d", resp.StatusCode)
+	}
+	if entries, _ := os.ReadDir(windowDir); len(entries) != 0 {
+		t.Errorf("expected no run directory for a conflicting window, got %d entries", len(entries))
+	}
+}
+
+func TestContinuousRetention(t *testing.T) {
+	tl := loggingtest.NewTestLogger(t)
+	dir := t.TempDir()
+
+	c, err := StartContinuous(tl.ProgramLogger, ContinuousOptions{
+		Dir:         dir,
+		Interval:    20 * time.Millisecond,
+		CPUDuration: 5 * time.Millisecond,
+		Profiles:    []Profile{ProfileHeap},
+		MaxRuns:     2,
+	})
+	if err != nil {
+		t.Fatalf("start continuous: %v", err)
+	}
+
+	// Wait for more captures than are kept.
+	deadline := time.Now().Add(10 * time.Second)
+	for captured := 0; captured < 4 && time.Now().Before(deadline); {
+		captured = 0
+		for _, e := range tl.EntriesAt(loggingtest.LevelInfo) {
+			if strings.Contains(e.Message, "Captured continuous profile") {
+				captured++
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Stop()
+
+	runs, err := listRuns(dir, defaultContinuousName)
+	if err != nil {
+		t.Fatalf("list runs: %v", err)
+	}
+	if len(runs) > 2 {
+		t.Errorf("expected at most 2 runs kept, got %d", len(runs))
+	}
+	tl.AssertLogged(t, loggingtest.LevelInfo, "Captured continuous profile")
+}
+
+// retained keeps memory live across a heap profile.
+var retained [][]byte
+
+func TestListRunsOrder(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{
+		"run_2024-05-01_10-00-00_10",
+		"run_2024-05-01_10-00-00_2",
+		"run_2024-05-01_10-00-01",
+		"run_2024-05-01_10-00-00",
+		"run_notes",
+		"other_2024-05-01_09-00-00",
+	}
+	for _, name := range names {
+		if err := os.Mkdir(filepath.Join(dir, name), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+	}
+
+	runs, err := listRuns(dir, "run")
+	if err != nil {
+		t.Fatalf("list runs: %v", err)
+	}
+	var got []string
+	for _, r := range runs {
+		got = append(got, filepath.Base(r.path))
+	}
+	want := []string{"run_2024-05-01_10-00-00", "run_2024-05-01_10-00-00_2", "run_2024-05-01_10-00-00_10", "run_2024-05-01_10-00-01"}
+	if !slices.Equal(got, want) {
+		t.Errorf("expected runs oldest first %v, got %v", want, got)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tl := loggingtest.NewTestLogger(t)
+	dir := t.TempDir()
+
+	run := func(retain int) string {
+		s, err := NewSession(tl.ProgramLogger, Options{Dir: dir, Profiles: []Profile{ProfileHeap}})
+		if err != nil {
+			t.Fatalf("new session: %v", err)
+		}
+		if err := s.Start(); err != nil {
+			t.Fatalf("start: %v", err)
+		}
+		for range retain {
+			retained = append(retained, make([]byte, 1<<20))
+		}
+		if err := s.Stop(); err != nil {
+			t.Fatalf("stop: %v", err)
+		}
+		retained = nil
+		return s.RunDir()
+	}
+
+	baseDir := run(0)
+	newDir := run(32)
+
+	report, err := Compare(baseDir, newDir, CompareOptions{})
+	if err != nil {
+		t.Fatalf("compare: %v", err)
+	}
+	if len(report.Diffs) != 1 || report.Diffs[0].Profile != ProfileHeap {
+		t.Fatalf("expected one heap diff, got %+v", report.Diffs)
+	}
+	if !strings.Contains(report.String(), "TestCompare") {
+		t.Errorf("expected allocating test function in report:\n%s", report)
+	}
+
+	if _, err := Compare(baseDir, newDir, CompareOptions{Threshold: 10}); !errors.Is(err, ErrRegression) {
+		t.Errorf("expected regression error, got %v", err)
+	}
+	if _, err := Compare(baseDir, t.TempDir(), CompareOptions{}); err == nil {
+		t.Errorf("expected error comparing against empty directory")
+	}
+}
+
+func TestSessionRuntimeStats(t *testing.T) {
+	for _, format := range []string{SampleFormatJSONL, SampleFormatCSV} {
+		tl := loggingtest.NewTestLogger(t)
+
+		s, err := NewSession(tl.ProgramLogger, Options{
+			Dir:            t.TempDir(),
+			Profiles:       []Profile{ProfileGoroutine},
+			SampleInterval: 5 * time.Millisecond,
+			SampleFormat:   format,
+		})
+		if err != nil {
+			t.Fatalf("new session: %v", err)
+		}
+		if err := s.Start(); err != nil {
+			t.Fatalf("start: %v", err)
+		}
+		time.Sleep(30 * time.Millisecond)
+		if err := s.Stop(); err != nil {
+			t.Fatalf("stop: %v", err)
+		}
+
+		m := readManifest(t, s.RunDir())
+		if m.RuntimeStats == nil || m.RuntimeStats.Samples < 2 || m.RuntimeStats.PeakHeapBytes == 0 {
+			t.Errorf("unexpected runtime stats summary: %+v", m.RuntimeStats)
+		}
+
+		data, err := os.ReadFile(filepath.Join(s.RunDir(), runtimeStatsFile+"."+format))
+		if err != nil {
+			t.Fatalf("read runtime stats: %v", err)
+		}
+		if lines := strings.Count(string(data), "\n"); lines < 2 {
+			t.Errorf("expected at least 2 %s lines, got %d", format, lines)
+		}
+		tl.AssertLogged(t, loggingtest.LevelInfo, "peak heap")
+	}
+}
+
+func TestSpans(t *testing.T) {
+	tl := loggingtest.NewTestLogger(t)
+
+	s, err := NewSession(tl.ProgramLogger, Options{Dir: t.TempDir(), Profiles: []Profile{ProfileTrace}})
+	if err != nil {
+		t.Fatalf("new session: %v", err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	for i := range 3 {
+		ctx, span := Span(context.Background(), "transcode", NewAttr("file", i))
+		_, inner := Span(ctx, "probe")
+		time.Sleep(time.Millisecond)
+		inner.End()
+		if d := span.End(); d < time.Millisecond {
+			t.Errorf("expected span of at least 1ms, got %s", d)
+		}
+		span.End() // No-op.
+	}
+
+	if err := s.Stop(); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.RunDir(), spansFile))
+	if err != nil {
+		t.Fatalf("read span summary: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], "transcode") || !strings.Contains(lines[1], " 3 ") {
+		t.Errorf("unexpected span summary:\n%s", data)
+	}
+
+	// Spans after the session stopped are not recorded.
+	_, span := Span(context.Background(), "late")
+	span.End()
+	s.spans.mu.Lock()
+	_, late := s.spans.hists["late"]
+	s.spans.mu.Unlock()
+	if late {
+		t.Errorf("span recorded after session stopped")
+	}
+}
+
+// Results ----------------------------------------------------------------------------------------
+
+func TestResults(t *testing.T) {
+	tl := loggingtest.NewTestLogger(t)
+
+	s, err := NewSession(tl.ProgramLogger, Options{Dir: t.TempDir(), Profiles: []Profile{ProfileTrace}})
+	if err != nil {
+		t.Fatalf("new session: %v", err)
+	}
+	if err := s.Start(); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	s.Record("encode files", Measurement{
+		N:        4,
+		Duration: 2 * time.Second,
+		Bytes:    8_000_000,
+		Metrics:  map[string]float64{"files": 4},
+	})
+	m := s.Measure("BenchmarkAlloc", 10, 0, func() {
+		for range 10 {
+			retained = append(retained, make([]byte, 1024))
+		}
+	})
+	if m.Allocs == 0 || m.AllocBytes == 0 {
+		t.Errorf("expected allocations measured, got %+v", m)
+	}
+
+	if err := s.Stop(); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(s.RunDir(), resultsFile))
+	if err != nil {
+		t.Fatalf("read results: %v", err)
+	}
+	procs := runtime.GOMAXPROCS(0)
+	want := fmt.Sprintf("BenchmarkEncode_files-%d\t4\t500000000 ns/op\t4.00 MB/s\t4 files\n", procs)
+	if !strings.Contains(string(data), want) {
+		t.Errorf("missing line %q in results:\n%s", want, data)
+	}
+	if !strings.Contains(string(data), fmt.Sprintf("BenchmarkAlloc-%d\t10\t", procs)) || !strings.Contains(string(data), "allocs/op") {
+		t.Errorf("unexpected measured line in results:\n%s", data)
+	}
+
+	manifest := readManifest(t, s.RunDir())
+	if !slices.ContainsFunc(manifest.Files, func(f ManifestFile) bool { return f.Path == resultsFile }) {
+		t.Errorf("results file missing from manifest: %+v", manifest.Files)
+	}
+
+	// Names are reduced to benchstat-safe identifiers.
+	for name, want := range map[string]string{
+		"encode files-hevc":  "BenchmarkEncode_files_hevc",
+		"  trim  -2  ":       "BenchmarkTrim_2",
+		"BenchmarkParse/tag": "BenchmarkParse_tag",
+		"écrire x":           "BenchmarkCrire_x",
+		"--":                 "BenchmarkUnnamed",
+	} {
+		if got := benchName(name); got != want {
+			t.Errorf("benchName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+// FromConfig -------------------------------------------------------------------------------------
+
+func TestFromConfig(t *testing.T) {
+	t.Cleanup(abstractions.SetDefaultConfig(abstractions.NewMemory(nil)))
+
+	cfg, err := FromConfig()
+	if err != nil || cfg.Enabled {
+		t.Fatalf("expected disabled config without error, got %+v, %v", cfg, err)
+	}
+
+	dir := t.TempDir()
+	abstractions.Set(KeyBenchmark, true)
+	abstractions.Set(KeyBenchmarkDir, dir)
+	abstractions.Set(KeyBenchmarkProfiles, []string{"CPU, heap", "block"})
+	abstractions.Set(KeyBenchmarkBlockProfileRate, 100)
+	abstractions.Set(KeyBenchmarkSampleInterval, "250ms")
+	abstractions.Set(KeyBenchmarkSampleFormat, "CSV")
+
+	cfg, err = FromConfig()
+	if err != nil {
+		t.Fatalf("from config: %v", err)
+	}
+	if !cfg.Enabled || cfg.Dir != dir || cfg.BlockProfileRate != 100 ||
+		cfg.SampleInterval != 250*time.Millisecond || cfg.SampleFormat != SampleFormatCSV ||
+		!slices.Equal(cfg.Profiles, []Profile{ProfileCPU, ProfileHeap, ProfileBlock}) {
+		t.Errorf("unexpected config: %+v", cfg)
+	}
+
+	for key, value := range map[string]any{
+		KeyBenchmarkProfiles:         "cpu,gpu",
+		KeyBenchmarkSampleFormat:     "xml",
+		KeyBenchmarkSampleInterval:   "soon",
+		KeyBenchmarkDir:              "",
+		KeyBenchmarkBlockProfileRate: "abc",
+		KeyBenchmarkHandleSignals:    "maybe",
+	} {
+		t.Run(key, func(t *testing.T) {
+			prev := abstractions.Get(key)
+			abstractions.Set(key, value)
+			defer abstractions.Set(key, prev)
+
+			if _, err := FromConfig(); err == nil {
+				t.Errorf("expected error for %s = %v", key, value)
+			}
+		})
+	}
+
+	// Malformed values are reported with their key, not read as zero.
+	abstractions.Set(KeyBenchmarkBlockProfileRate, "abc")
+	var keyErr *abstractions.KeyError
+	if _, err := FromConfig(); !errors.Is(err, abstractions.ErrParse) || !errors.As(err, &keyErr) || keyErr.Key != KeyBenchmarkBlockProfileRate {
+		t.Errorf("expected parse error for %s, got %v", KeyBenchmarkBlockProfileRate, err)
+	}
+	abstractions.Set(KeyBenchmarkBlockProfileRate, 100)
+
+	// Disabled setup does nothing.
+	abstractions.Set(KeyBenchmark, false)
+	tl := loggingtest.NewTestLogger(t)
+	b, err := SetupFromConfig(tl.ProgramLogger)
+	if b != nil || err != nil {
+		t.Errorf("expected no benchmark files when disabled, got %v, %v", b, err)
+	}
+}
+
+// Finalization -----------------------------------------------------------------------------------
+
+func TestRunStatus(t *testing.T) {
+	tl := loggingtest.NewTestLogger(t)
+
+	start := func(opts Options) *Session {
+		t.Helper()
+		opts.Dir = t.TempDir()
+		opts.Profiles = []Profile{ProfileCPU, ProfileTrace}
+		s, err := NewSession(tl.ProgramLogger, opts)
+		if err != nil {
+			t.Fatalf("new session: %v", err)
+		}
+		if err := s.Start(); err != nil {
+			t.Fatalf("start: %v", err)
+		}
+		return s
+	}
+	status := func(s *Session) RunStatus {
+		t.Helper()
+		m, err := ReadManifest(s.RunDir())
+		if err != nil {
+			t.Fatalf("read manifest: %v", err)
+		}
+		return m.Status
+	}
+
+	// Running until stopped.
+	s := start(Options{})
+	if got := status(s); got != StatusRunning {
+		t.Errorf("expected %q after start, got %q", StatusRunning, got)
+	}
+	if err := s.Stop(); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if got := status(s); got != StatusComplete {
+		t.Errorf("expected %q after stop, got %q", StatusComplete, got)
+	}
+
+	// Recovered panics mark the run.
+	s = start(Options{HandlePanics: true})
+	func() {
+		defer tl.Recover()
+		panic("recovered")
+	}()
+	if err := s.Stop(); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	if got := status(s); got != StatusPanicked {
+		t.Errorf("expected %q after recovered panic, got %q", StatusPanicked, got)
+	}
+
+	// Fatal panics finalize the run.
+	s = start(Options{HandlePanics: true})
+	s.onPanic("fatal", true)
+	if got := status(s); got != StatusPanicked {
+		t.Errorf("expected %q after fatal panic, got %q", StatusPanicked, got)
+	}
+	if _, err := parseProfile(filepath.Join(s.RunDir(), profileFiles[ProfileCPU])); err != nil {
+		t.Errorf("expected finalized CPU profile: %v", err)
+	}
+
+	// Fatal panics raised while the session lock is held do not deadlock.
+	held := start(Options{HandlePanics: true})
+	held.mu.Lock()
+	done := make(chan struct{})
+	go func() {
+		held.onPanic("fatal", true)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("fatal panic handling deadlocked on the session lock")
+	}
+	held.mu.Unlock()
+	if got := status(held); got != StatusPanicked {
+		t.Errorf("expected %q after fatal panic under lock, got %q", StatusPanicked, got)
+	}
+
+	// Unclean runs are flagged by Compare.
+	clean := start(Options{})
+	if err := clean.Stop(); err != nil {
+		t.Fatalf("stop: %v", err)
+	}
+	report, err := Compare(clean.RunDir(), s.RunDir(), CompareOptions{})
+	if err != nil {
+		t.Fatalf("compare: %v", err)
+	}
+	if len(report.Warnings) != 1 || !strings.Contains(report.String(), "did not finish cleanly") {
+		t.Errorf("expected unclean run warning, got %v", report.Warnings)
+	}
+	if _, err := Compare(clean.RunDir(), s.RunDir(), CompareOptions{RequireClean: true}); !errors.Is(err, ErrUncleanRun) {
+		t.Errorf("expected ErrUncleanRun, got %v", err)
+	}
+}
+
+func TestSignalFinalization(t *testing.T) {
+	tl := loggingtest.NewTestLogger(t)
+
+	for _, reraise := range []bool{false, true} {
+		s, err := NewSession(tl.ProgramLogger, Options{
+			Dir:            t.TempDir(),
+			Profiles:       []Profile{ProfileCPU},
+			HandleSignals:  true,
+			ReraiseSignals: reraise,
+		})
+		if err != nil {
+			t.Fatalf("new session: %v", err)
+		}
+
+		// Deliver the signal through the session, not the OS.
+		s.signals = make(chan os.Signal, 1)
+		reraised := make(chan os.Signal, 1)
+		s.reraise = func(sig os.Signal) { reraised <- sig }
+
+		if err := s.Start(); err != nil {
+			t.Fatalf("start: %v", err)
+		}
+		s.signals <- os.Interrupt
+
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if m, err := ReadManifest(s.RunDir()); err == nil && m.Status == StatusInterrupted {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if m, err := ReadManifest(s.RunDir()); err != nil || m.Status != StatusInterrupted {
+			t.Fatalf("expected run finalized as %q, got %q, %v", StatusInterrupted, m.Status, err)
+		}
+
+		if reraise {
+			select {
+			case sig := <-reraised:
+				if sig != os.Interrupt {
+					t.Errorf("expected %v re-raised, got %v", os.Interrupt, sig)
+				}
+			case <-time.After(5 * time.Second):
+				t.Errorf("expected %v to be re-raised", os.Interrupt)
+			}
+			continue
+		}
+		time.Sleep(50 * time.Millisecond)
+		if len(reraised) > 0 {
+			t.Errorf("expected no re-raise without ReraiseSignals")
+		}
+	}
+}
@@ -0,0 +1,172 @@
+package benchmark
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+
+	"github.com/TubarrApp/gocommon/logging"
+)
+
+// Window constants.
+const (
+	DefaultWindowDuration = 30 * time.Second
+	defaultWindowName     = "window"
+)
+
+// WindowController runs on-demand profiling windows for long-running programs.
+//
+// Each window is a session written to its own timestamped run directory. Only one window runs at a time.
+// A window collecting a CPU profile or trace cannot start while another session collects one.
+type WindowController struct {
+	log  *logging.ProgramLogger
+	opts Options
+
+	mu     sync.Mutex
+	active *Session
+	timer  *time.Timer
+	ends   time.Time
+}
+
+// WindowStatus describes the current window.
+type WindowStatus struct {
+	Active bool      `json:"active"`
+	RunDir string    `json:"run_dir,omitempty"`
+	Ends   time.Time `json:"ends,omitzero"`
+}
+
+// NewWindowController returns a controller starting windows with the given session options.
+func NewWindowController(log *logging.ProgramLogger, opts Options) (*WindowController, error) {
+	if opts.Name == "" {
+		opts.Name = defaultWindowName
+	}
+
+	// Validate options up front.
+	if _, err := NewSession(log, opts); err != nil {
+		return nil, err
+	}
+
+	return &WindowController{
+		log:  log,
+		opts: opts,
+	}, nil
+}
+
+// Start begins a profiling window which stops itself after d (DefaultWindowDuration if 0).
+func (c *WindowController) Start(d time.Duration) (runDir string, err error) {
+	if d <= 0 {
+		d = DefaultWindowDuration
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.active != nil {
+		return "", stateError(fmt.Sprintf("profiling window already running until %s", c.ends.Format(time.TimeOnly)))
+	}
+
+	s, err := NewSession(c.log, c.opts)
+	if err != nil {
+		return "", err
+	}
+	if err := s.Start(); err != nil {
+		return "", err
+	}
+
+	c.active = s
+	c.ends = time.Now().Add(d)
+	c.timer = time.AfterFunc(d, func() {
+		if err := c.finish(s); err != nil {
+			c.log.E("Failed to finish profiling window: %v", err)
+		}
+	})
+
+	c.log.I("Started %s profiling window in %q", d, s.RunDir())
+	return s.RunDir(), nil
+}
+
+// Stop ends the running window early.
+func (c *WindowController) Stop() error {
+	c.mu.Lock()
+	s := c.active
+	c.mu.Unlock()
+
+	if s == nil {
+		return stateError("no profiling window running")
+	}
+	return c.finish(s)
+}
+
+// Status returns the state of the current window.
+func (c *WindowController) Status() WindowStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.active == nil {
+		return WindowStatus{}
+	}
+	return WindowStatus{
+		Active: true,
+		RunDir: c.active.RunDir(),
+		Ends:   c.ends,
+	}
+}
+
+// NotifySignal starts a window of length d whenever one of the signals arrives.
+//
+// Defaults to SIGUSR1 on Unix systems. Returns a function which stops listening.
+func (c *WindowController) NotifySignal(d time.Duration, sigs ...os.Signal) (stop func()) {
+	if len(sigs) == 0 {
+		sigs = defaultWindowSignals
+	}
+	if len(sigs) == 0 {
+		c.log.W("No profiling window signal available on this platform")
+		return func() {}
+	}
+
+	ch := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(ch, sigs...)
+
+	c.log.Go(func() {
+		for {
+			select {
+			case sig := <-ch:
+				c.log.I("Received %v, starting profiling window", sig)
+				if _, err := c.Start(d); err != nil {
+					c.log.W("Could not start profiling window: %v", err)
+				}
+			case <-done:
+				return
+			}
+		}
+	})
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
+
+// finish stops the session if it is still the active window.
+func (c *WindowController) finish(s *Session) error {
+	c.mu.Lock()
+	if c.active != s {
+		c.mu.Unlock()
+		return nil // Already finished.
+	}
+	c.active = nil
+	c.timer.Stop()
+	c.mu.Unlock()
+
+	if err := s.Stop(); err != nil {
+		return err
+	}
+	c.log.I("Profiling window finished, files written to %q", s.RunDir())
+	return nil
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package benchmark
+
+import "os"
+
+// defaultWindowSignals is empty, SIGUSR1 is not available on this platform.
+var defaultWindowSignals []os.Signal
@@ -0,0 +1,11 @@
+//go:build unix
+
+package benchmark
+
+import (
+	"os"
+	"syscall"
+)
+
+// defaultWindowSignals start profiling windows when no signals are given.
+var defaultWindowSignals = []os.Signal{syscall.SIGUSR1}
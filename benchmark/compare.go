@@ -0,0 +1,364 @@
+package benchmark
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/google/pprof/profile"
+)
+
+// Comparison errors.
+var (
+	ErrRegression = errors.New("performance regression")     // A profile total grew past the threshold.
+	ErrUncleanRun = errors.New("run did not finish cleanly") // A run's manifest status is not complete.
+)
+
+// Comparison defaults.
+const defaultCompareTop = 15
+
+// compareSampleTypes are the sample types compared for each profile.
+var compareSampleTypes = map[Profile]string{
+	ProfileCPU:  "cpu",
+	ProfileHeap: "inuse_space",
+}
+
+// CompareOptions configure a run comparison.
+type CompareOptions struct {
+	Top       int     // Functions listed per profile, by largest flat change (15 if 0).
+	Threshold float64 // Percent growth of a profile total counted as a regression, 0 disables.
+
+	RequireClean bool // Fail with ErrUncleanRun instead of warning if either run did not finish cleanly.
+}
+
+// FuncDelta is the change in one function's flat and cumulative values between runs.
+type FuncDelta struct {
+	Name     string
+	BaseFlat int64
+	NewFlat  int64
+	BaseCum  int64
+	NewCum   int64
+}
+
+// FlatDelta returns the change in flat value.
+func (d FuncDelta) FlatDelta() int64 {
+	return d.NewFlat - d.BaseFlat
+}
+
+// CumDelta returns the change in cumulative value.
+func (d FuncDelta) CumDelta() int64 {
+	return d.NewCum - d.BaseCum
+}
+
+// ProfileDiff compares one profile type between two runs.
+type ProfileDiff struct {
+	Profile    Profile
+	SampleType string // e.g. "cpu" or "inuse_space".
+	Unit       string // e.g. "nanoseconds" or "bytes".
+	BaseTotal  int64
+	NewTotal   int64
+	Funcs      []FuncDelta // Largest flat changes first.
+}
+
+// TotalChange returns the percent change of the profile total.
+func (d ProfileDiff) TotalChange() float64 {
+	if d.BaseTotal == 0 {
+		if d.NewTotal == 0 {
+			return 0
+		}
+		return 100
+	}
+	return float64(d.NewTotal-d.BaseTotal) / float64(d.BaseTotal) * 100
+}
+
+// Report is the result of comparing two run directories.
+type Report struct {
+	BaseDir  string
+	NewDir   string
+	Diffs    []ProfileDiff
+	Warnings []string // e.g. runs which did not finish cleanly.
+}
+
+// Compare loads the CPU and heap profiles from two run directories and compares them by function.
+//
+// Profiles missing from either run are skipped. Runs whose manifest shows they did not finish cleanly
+// are flagged in the report warnings, or rejected if opts.RequireClean is set. If opts.Threshold is set and any profile total grew
+// by more than that percentage, the report is returned along with an error wrapping ErrRegression.
+func Compare(baseDir, newDir string, opts CompareOptions) (*Report, error) {
+	if opts.Top <= 0 {
+		opts.Top = defaultCompareTop
+	}
+
+	report := &Report{
+		BaseDir: baseDir,
+		NewDir:  newDir,
+	}
+
+	// Flag unclean runs, runs without a manifest or status predate run statuses.
+	for _, dir := range []string{baseDir, newDir} {
+		m, err := ReadManifest(dir)
+		if err != nil || m.Status == "" || m.Clean() {
+			continue
+		}
+		if opts.RequireClean {
+			return nil, fmt.Errorf("%w: %q has status %q", ErrUncleanRun, dir, m.Status)
+		}
+		report.Warnings = append(report.Warnings, fmt.Sprintf("run %q did not finish cleanly (status %q), profiles may be truncated", dir, m.Status))
+	}
+
+	for _, p := range []Profile{ProfileCPU, ProfileHeap} {
+		basePath := filepath.Join(baseDir, profileFiles[p])
+		newPath := filepath.Join(newDir, profileFiles[p])
+		if !fileExists(basePath) || !fileExists(newPath) {
+			continue
+		}
+
+		diff, err := compareProfiles(p, basePath, newPath, opts.Top)
+		if err != nil {
+			return nil, err
+		}
+		report.Diffs = append(report.Diffs, diff)
+	}
+
+	if len(report.Diffs) == 0 {
+		return nil, fmt.Errorf("no CPU or heap profiles found in both %q and %q", baseDir, newDir)
+	}
+
+	// Check regression threshold.
+	if opts.Threshold > 0 {
+		var regressed []string
+		for _, d := range report.Diffs {
+			if change := d.TotalChange(); change > opts.Threshold {
+				regressed = append(regressed, fmt.Sprintf("%s %+.1f%%", d.Profile, change))
+			}
+		}
+		if len(regressed) > 0 {
+			return report, fmt.Errorf("%w over %.1f%%: %s", ErrRegression, opts.Threshold, strings.Join(regressed, ", "))
+		}
+	}
+
+	return report, nil
+}
+
+// WriteText writes the report as aligned text tables.
+func (r *Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+
+	fmt.Fprintf(tw, "Comparing %q -> %q\n", r.BaseDir, r.NewDir)
+	for _, warning := range r.Warnings {
+		fmt.Fprintf(tw, "Warning: %s\n", warning)
+	}
+	for _, d := range r.Diffs {
+		fmt.Fprintf(tw, "\n%s (%s): total %s -> %s (%+.1f%%)\n",
+			d.Profile, d.SampleType, formatValue(d.BaseTotal, d.Unit), formatValue(d.NewTotal, d.Unit), d.TotalChange())
+
+		fmt.Fprintln(tw, "base flat\tnew flat\tdelta flat\tbase cum\tnew cum\tdelta cum\t\tfunction")
+		for _, f := range d.Funcs {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t\t%s\n",
+				formatValue(f.BaseFlat, d.Unit),
+				formatValue(f.NewFlat, d.Unit),
+				formatDelta(f.FlatDelta(), d.Unit),
+				formatValue(f.BaseCum, d.Unit),
+				formatValue(f.NewCum, d.Unit),
+				formatDelta(f.CumDelta(), d.Unit),
+				f.Name)
+		}
+	}
+
+	return tw.Flush()
+}
+
+// String returns the report as text.
+func (r *Report) String() string {
+	var b strings.Builder
+	_ = r.WriteText(&b)
+	return b.String()
+}
+
+// **** Private **********************************************************************************
+
+// funcValues holds flat and cumulative values for one function in one profile.
+type funcValues struct {
+	flat int64
+	cum  int64
+}
+
+// compareProfiles parses both profiles and diffs them by function.
+func compareProfiles(p Profile, basePath, newPath string, top int) (ProfileDiff, error) {
+	baseProf, err := parseProfile(basePath)
+	if err != nil {
+		return ProfileDiff{}, err
+	}
+	newProf, err := parseProfile(newPath)
+	if err != nil {
+		return ProfileDiff{}, err
+	}
+
+	sampleType := compareSampleTypes[p]
+	baseIdx, unit := sampleIndex(baseProf, sampleType)
+	newIdx, _ := sampleIndex(newProf, sampleType)
+
+	baseFuncs, baseTotal := aggregateFuncs(baseProf, baseIdx)
+	newFuncs, newTotal := aggregateFuncs(newProf, newIdx)
+
+	// Merge function names from both runs.
+	deltas := make([]FuncDelta, 0, max(len(baseFuncs), len(newFuncs)))
+	for name, b := range baseFuncs {
+		n := newFuncs[name]
+		deltas = append(deltas, FuncDelta{Name: name, BaseFlat: b.flat, NewFlat: n.flat, BaseCum: b.cum, NewCum: n.cum})
+	}
+	for name, n := range newFuncs {
+		if _, ok := baseFuncs[name]; !ok {
+			deltas = append(deltas, FuncDelta{Name: name, NewFlat: n.flat, NewCum: n.cum})
+		}
+	}
+
+	// Unchanged functions are not interesting.
+	deltas = slices.DeleteFunc(deltas, func(d FuncDelta) bool {
+		return d.FlatDelta() == 0 && d.CumDelta() == 0
+	})
+
+	// Largest absolute flat change first, then cumulative change, then name.
+	slices.SortFunc(deltas, func(a, b FuncDelta) int {
+		if c := cmp.Compare(abs(b.FlatDelta()), abs(a.FlatDelta())); c != 0 {
+			return c
+		}
+		if c := cmp.Compare(abs(b.CumDelta()), abs(a.CumDelta())); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	if len(deltas) > top {
+		deltas = deltas[:top]
+	}
+
+	return ProfileDiff{
+		Profile:    p,
+		SampleType: sampleType,
+		Unit:       unit,
+		BaseTotal:  baseTotal,
+		NewTotal:   newTotal,
+		Funcs:      deltas,
+	}, nil
+}
+
+// parseProfile reads a pprof profile from disk.
+func parseProfile(path string) (*profile.Profile, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not open profile %q: %w", path, err)
+	}
+	defer f.Close()
+
+	prof, err := profile.Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse profile %q: %w", path, err)
+	}
+	return prof, nil
+}
+
+// sampleIndex returns the index and unit of the named sample type, or the last sample type.
+func sampleIndex(prof *profile.Profile, name string) (int, string) {
+	for i, st := range prof.SampleType {
+		if st.Type == name {
+			return i, st.Unit
+		}
+	}
+	if n := len(prof.SampleType); n > 0 {
+		return n - 1, prof.SampleType[n-1].Unit
+	}
+	return 0, ""
+}
+
+// aggregateFuncs sums flat (leaf) and cumulative (anywhere on stack) values per function.
+func aggregateFuncs(prof *profile.Profile, idx int) (funcs map[string]funcValues, total int64) {
+	funcs = make(map[string]funcValues)
+
+	for _, s := range prof.Sample {
+		if idx >= len(s.Value) {
+			continue
+		}
+		v := s.Value[idx]
+		total += v
+
+		seen := make(map[string]struct{})
+		for i, loc := range s.Location {
+			for j, line := range loc.Line {
+				if line.Function == nil {
+					continue
+				}
+				name := line.Function.Name
+
+				// Leaf function (first line of first location) gets the flat value.
+				fv := funcs[name]
+				if i == 0 && j == 0 {
+					fv.flat += v
+				}
+				// Count each function once per sample for cumulative values (recursion).
+				if _, ok := seen[name]; !ok {
+					seen[name] = struct{}{}
+					fv.cum += v
+				}
+				funcs[name] = fv
+			}
+		}
+	}
+	return funcs, total
+}
+
+// formatValue formats a sample value according to its unit.
+func formatValue(v int64, unit string) string {
+	switch unit {
+	case "nanoseconds":
+		return time.Duration(v).Round(time.Microsecond).String()
+	case "bytes":
+		return formatBytes(v)
+	default:
+		return fmt.Sprintf("%d", v)
+	}
+}
+
+// formatDelta formats a signed sample value change.
+func formatDelta(v int64, unit string) string {
+	if v >= 0 {
+		return "+" + formatValue(v, unit)
+	}
+	return "-" + formatValue(-v, unit)
+}
+
+// formatBytes formats a byte count with a binary unit suffix.
+func formatBytes(v int64) string {
+	const unit = 1024
+	if v < unit && v > -unit {
+		return fmt.Sprintf("%dB", v)
+	}
+	f := float64(v)
+	for _, suffix := range []string{"KB", "MB", "GB", "TB"} {
+		f /= unit
+		if f < unit && f > -unit {
+			return fmt.Sprintf("%.2f%s", f, suffix)
+		}
+	}
+	return fmt.Sprintf("%.2fPB", f/unit)
+}
+
+// abs returns the absolute value of v.
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// fileExists returns true if path exists and is a regular file.
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
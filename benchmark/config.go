@@ -0,0 +1,114 @@
+package benchmark
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/TubarrApp/gocommon/abstractions"
+	"github.com/TubarrApp/gocommon/logging"
+)
+
+// Config keys, shared by programs for benchmark flags and config files.
+const (
+	KeyBenchmark                     = "benchmark"
+	KeyBenchmarkDir                  = "benchmark-dir"
+	KeyBenchmarkName                 = "benchmark-name"
+	KeyBenchmarkProfiles             = "benchmark-profiles"
+	KeyBenchmarkBlockProfileRate     = "benchmark-block-profile-rate"
+	KeyBenchmarkMutexProfileFraction = "benchmark-mutex-profile-fraction"
+	KeyBenchmarkMemProfileRate       = "benchmark-mem-profile-rate"
+	KeyBenchmarkSampleInterval       = "benchmark-sample-interval"
+	KeyBenchmarkSampleFormat         = "benchmark-sample-format"
+	KeyBenchmarkHandleSignals        = "benchmark-handle-signals"
+	KeyBenchmarkReraiseSignals       = "benchmark-reraise-signals"
+	KeyBenchmarkHandlePanics         = "benchmark-handle-panics"
+)
+
+// Config is the benchmark configuration read from config keys.
+type Config struct {
+	Enabled bool
+	Options
+}
+
+// FromConfig reads the benchmark configuration through the abstractions getters.
+//
+// Options are checked whether or not benchmarking is enabled, so config mistakes surface early.
+// Unset keys are left at their zero value, malformed values are errors.
+func FromConfig() (Config, error) {
+	var errs []error
+	cfg := Config{
+		Enabled: configValue(&errs, abstractions.GetBoolE, KeyBenchmark),
+		Options: Options{
+			Dir:                  configValue(&errs, abstractions.GetStringE, KeyBenchmarkDir),
+			Name:                 configValue(&errs, abstractions.GetStringE, KeyBenchmarkName),
+			BlockProfileRate:     configValue(&errs, abstractions.GetIntE, KeyBenchmarkBlockProfileRate),
+			MutexProfileFraction: configValue(&errs, abstractions.GetIntE, KeyBenchmarkMutexProfileFraction),
+			MemProfileRate:       configValue(&errs, abstractions.GetIntE, KeyBenchmarkMemProfileRate),
+			SampleInterval:       configValue(&errs, abstractions.GetDurationE, KeyBenchmarkSampleInterval),
+			SampleFormat:         strings.ToLower(strings.TrimSpace(configValue(&errs, abstractions.GetStringE, KeyBenchmarkSampleFormat))),
+			HandleSignals:        configValue(&errs, abstractions.GetBoolE, KeyBenchmarkHandleSignals),
+			ReraiseSignals:       configValue(&errs, abstractions.GetBoolE, KeyBenchmarkReraiseSignals),
+			HandlePanics:         configValue(&errs, abstractions.GetBoolE, KeyBenchmarkHandlePanics),
+		},
+	}
+	profiles := configValue(&errs, abstractions.GetStringSliceE, KeyBenchmarkProfiles)
+	if err := errors.Join(errs...); err != nil {
+		return Config{}, err
+	}
+
+	// Profiles, e.g. "cpu,heap" from a flag or a list from a config file.
+	for _, entry := range profiles {
+		for name := range strings.SplitSeq(entry, ",") {
+			name = strings.ToLower(strings.TrimSpace(name))
+			if name == "" {
+				continue
+			}
+			p := Profile(name)
+			if _, ok := ValidProfiles[p]; !ok {
+				return Config{}, fmt.Errorf("%s: profile type %q is not valid", KeyBenchmarkProfiles, name)
+			}
+			cfg.Profiles = append(cfg.Profiles, p)
+		}
+	}
+
+	switch cfg.SampleFormat {
+	case "", SampleFormatJSONL, SampleFormatCSV:
+	default:
+		return Config{}, fmt.Errorf("%s: runtime stats format %q is not valid", KeyBenchmarkSampleFormat, cfg.SampleFormat)
+	}
+	if cfg.SampleInterval < 0 {
+		return Config{}, fmt.Errorf("%s: interval %s must not be negative", KeyBenchmarkSampleInterval, cfg.SampleInterval)
+	}
+	if cfg.Enabled && cfg.Dir == "" {
+		return Config{}, fmt.Errorf("%s is required when %s is enabled", KeyBenchmarkDir, KeyBenchmark)
+	}
+
+	return cfg, nil
+}
+
+// SetupFromConfig sets up benchmarking from config keys. Returns nil files if benchmarking is disabled.
+func SetupFromConfig(log *logging.ProgramLogger) (*BenchFiles, error) {
+	cfg, err := FromConfig()
+	if err != nil {
+		log.E("Benchmarking failure: %v", err)
+		return nil, err
+	}
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	return setupSession(log, cfg.Options)
+}
+
+// **** Private **********************************************************************************
+
+// configValue reads a key with a strict getter, returning the zero value if the key is not set.
+//
+// Malformed values are appended to errs.
+func configValue[T any](errs *[]error, get func(string) (T, error), key string) T {
+	v, err := get(key)
+	if err != nil && !errors.Is(err, abstractions.ErrNotSet) {
+		*errs = append(*errs, err)
+	}
+	return v
+}
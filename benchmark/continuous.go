@@ -0,0 +1,265 @@
+package benchmark
+
+import (
+	"cmp"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/TubarrApp/gocommon/logging"
+)
+
+// Continuous profiling defaults.
+const (
+	DefaultContinuousInterval    = 15 * time.Minute
+	DefaultContinuousCPUDuration = 10 * time.Second
+	DefaultContinuousMaxRuns     = 96 // One day at the default interval.
+	defaultContinuousName        = "continuous"
+)
+
+// ContinuousOptions configure periodic low-overhead profiling.
+type ContinuousOptions struct {
+	Dir           string        // Base directory, each capture is a run directory inside it.
+	Name          string        // Run name prefix, also used to find old runs for retention ("continuous" if empty).
+	Interval      time.Duration // Time between captures (DefaultContinuousInterval if 0).
+	CPUDuration   time.Duration // Length of each CPU profile (DefaultContinuousCPUDuration if 0).
+	Profiles      []Profile     // Profiles per capture (CPU and heap if empty).
+	MaxRuns       int           // Run directories to keep (DefaultContinuousMaxRuns if 0).
+	MaxTotalBytes int64         // Total size of kept run directories, 0 for no limit.
+}
+
+// Continuous captures profiles periodically into rotating run directories.
+type Continuous struct {
+	log  *logging.ProgramLogger
+	opts ContinuousOptions
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// StartContinuous starts periodic captures. The first capture runs after one interval.
+func StartContinuous(log *logging.ProgramLogger, opts ContinuousOptions) (*Continuous, error) {
+	if opts.Name == "" {
+		opts.Name = defaultContinuousName
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultContinuousInterval
+	}
+	if opts.CPUDuration <= 0 {
+		opts.CPUDuration = DefaultContinuousCPUDuration
+	}
+	if opts.CPUDuration >= opts.Interval {
+		return nil, fmt.Errorf("CPU profile duration %s must be shorter than interval %s", opts.CPUDuration, opts.Interval)
+	}
+	if len(opts.Profiles) == 0 {
+		opts.Profiles = []Profile{ProfileCPU, ProfileHeap}
+	}
+	if opts.MaxRuns <= 0 {
+		opts.MaxRuns = DefaultContinuousMaxRuns
+	}
+
+	// Validate session options up front.
+	if _, err := NewSession(log, opts.sessionOptions()); err != nil {
+		return nil, err
+	}
+
+	c := &Continuous{
+		log:  log,
+		opts: opts,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	log.Go(c.run)
+
+	log.I("Continuous profiling every %s into %q (keeping %d runs)", opts.Interval, opts.Dir, opts.MaxRuns)
+	return c, nil
+}
+
+// Stop stops capturing, waiting for any capture in progress to be written.
+func (c *Continuous) Stop() {
+	c.once.Do(func() {
+		close(c.stop)
+	})
+	<-c.done
+}
+
+// run captures on every interval until stopped.
+func (c *Continuous) run() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := c.capture(); err != nil {
+				c.log.E("Continuous profile capture failed: %v", err)
+			}
+			if err := c.enforceRetention(); err != nil {
+				c.log.E("Continuous profile retention failed: %v", err)
+			}
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// capture runs one session, holding it open for the CPU duration if a CPU profile is collected.
+func (c *Continuous) capture() error {
+	s, err := NewSession(c.log, c.opts.sessionOptions())
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	if err := s.Start(); err != nil {
+		return err
+	}
+
+	// Interrupted captures are still written.
+	if slices.Contains(c.opts.Profiles, ProfileCPU) {
+		select {
+		case <-time.After(c.opts.CPUDuration):
+		case <-c.stop:
+		}
+	}
+
+	if err := s.Stop(); err != nil {
+		return err
+	}
+
+	c.log.I("Captured continuous profile in %q (took %s)", s.RunDir(), time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// sessionOptions returns the options for each capture.
+func (o ContinuousOptions) sessionOptions() Options {
+	return Options{
+		Dir:      o.Dir,
+		Name:     o.Name,
+		Profiles: o.Profiles,
+	}
+}
+
+// enforceRetention removes the oldest run directories until within the count and size limits.
+//
+// The newest run is always kept.
+func (c *Continuous) enforceRetention() error {
+	runs, err := listRuns(c.opts.Dir, c.opts.Name)
+	if err != nil {
+		return err
+	}
+
+	var total int64
+	for _, r := range runs {
+		total += r.size
+	}
+
+	for len(runs) > 1 &&
+		(len(runs) > c.opts.MaxRuns || (c.opts.MaxTotalBytes > 0 && total > c.opts.MaxTotalBytes)) {
+
+		oldest := runs[0]
+		if err := os.RemoveAll(oldest.path); err != nil {
+			return fmt.Errorf("could not remove old benchmark run %q: %w", oldest.path, err)
+		}
+		c.log.D(1, "Removed old continuous profile %q", oldest.path)
+
+		total -= oldest.size
+		runs = runs[1:]
+	}
+	return nil
+}
+
+// runDir is a run directory found on disk.
+type runDir struct {
+	path string
+	size int64
+
+	started time.Time
+	seq     int // Collision suffix from makeBenchFilepaths, 1 if none.
+}
+
+// listRuns returns run directories made by makeBenchFilepaths for the run name, oldest first.
+func listRuns(baseDir, name string) ([]runDir, error) {
+	entries, err := os.ReadDir(baseDir)
+	if err != nil {
+		return nil, fmt.Errorf("could not read benchmark directory %q: %w", baseDir, err)
+	}
+
+	prefix := name + "_"
+	var runs []runDir
+	for _, e := range entries {
+		rest, ok := strings.CutPrefix(e.Name(), prefix)
+		if !e.IsDir() || !ok {
+			continue
+		}
+		started, seq, ok := parseRunName(rest)
+		if !ok {
+			continue
+		}
+		path := filepath.Join(baseDir, e.Name())
+		size, err := dirSize(path)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, runDir{path: path, size: size, started: started, seq: seq})
+	}
+
+	slices.SortFunc(runs, func(a, b runDir) int {
+		if c := a.started.Compare(b.started); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.seq, b.seq)
+	})
+	return runs, nil
+}
+
+// parseRunName parses the timestamp and collision suffix of a run directory name, without the run name prefix.
+func parseRunName(s string) (started time.Time, seq int, ok bool) {
+	if len(s) < len(runTimeFormat) {
+		return time.Time{}, 0, false
+	}
+	started, err := time.ParseInLocation(runTimeFormat, s[:len(runTimeFormat)], time.Local)
+	if err != nil {
+		return time.Time{}, 0, false
+	}
+
+	seq = 1
+	if suffix := s[len(runTimeFormat):]; suffix != "" {
+		n, found := strings.CutPrefix(suffix, "_")
+		if seq, err = strconv.Atoi(n); !found || err != nil || seq < 2 {
+			return time.Time{}, 0, false
+		}
+	}
+	return started, seq, true
+}
+
+// dirSize returns the total size of regular files under dir.
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			size += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("could not size benchmark run %q: %w", dir, err)
+	}
+	return size, nil
+}
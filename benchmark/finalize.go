@@ -0,0 +1,134 @@
+package benchmark
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// RunStatus is the state of a run recorded in its manifest.
+type RunStatus string
+
+// Run statuses.
+const (
+	StatusRunning     RunStatus = "running"     // Started and not finalized, e.g. the process was killed.
+	StatusComplete    RunStatus = "complete"    // Stopped cleanly.
+	StatusInterrupted RunStatus = "interrupted" // Finalized on SIGINT or SIGTERM.
+	StatusPanicked    RunStatus = "panicked"    // A panic was recovered during the run.
+)
+
+// Clean returns true if the run finished cleanly, so its profiles are comparable.
+func (m Manifest) Clean() bool {
+	return m.Status == StatusComplete
+}
+
+// ReadManifest reads the manifest from a run directory.
+func ReadManifest(runDir string) (Manifest, error) {
+	path := filepath.Join(runDir, manifestFile)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("could not read benchmark manifest: %w", err)
+	}
+
+	var m Manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return Manifest{}, fmt.Errorf("could not decode benchmark manifest %q: %w", path, err)
+	}
+	return m, nil
+}
+
+// **** Private **********************************************************************************
+
+// panicLockWait is how long a fatal panic waits for the session lock before finalizing without it.
+const panicLockWait = time.Second
+
+// finalizeSignals finalize the session when received with HandleSignals set.
+var finalizeSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// startCrashHandling installs the signal handler and panic hook requested in the options.
+func (s *Session) startCrashHandling() {
+	s.finished = make(chan struct{})
+
+	if s.opts.HandlePanics {
+		s.removePanicHook = s.log.OnPanic(s.onPanic)
+	}
+
+	if s.opts.HandleSignals {
+		ch := s.signals
+		if ch == nil {
+			ch = make(chan os.Signal, 1)
+			signal.Notify(ch, finalizeSignals...)
+		}
+
+		finished := s.finished
+		go func() {
+			select {
+			case sig := <-ch:
+				s.log.W("Received %v, finalizing benchmark files", sig)
+				if err := s.finish(StatusInterrupted); err != nil {
+					s.log.E("Failed to finalize benchmark files: %v", err)
+				}
+				signal.Stop(ch)
+				if s.opts.ReraiseSignals {
+					s.reraise(sig)
+				}
+			case <-finished:
+				signal.Stop(ch)
+			}
+		}()
+	}
+}
+
+// stopCrashHandling removes the signal handler and panic hook.
+func (s *Session) stopCrashHandling() {
+	if s.removePanicHook != nil {
+		s.removePanicHook()
+		s.removePanicHook = nil
+	}
+	if s.finished != nil {
+		close(s.finished)
+		s.finished = nil
+	}
+}
+
+// onPanic finalizes the session on a fatal panic, or marks the run as panicked if the program continues.
+//
+// The panic may have been raised while s.mu was held, so the lock is only waited on for
+// panicLockWait. After that the session is finalized without it, the program is exiting anyway.
+func (s *Session) onPanic(_ any, fatal bool) {
+	s.panicked.Store(true)
+	if !fatal {
+		return
+	}
+
+	locked := false
+	for deadline := time.Now().Add(panicLockWait); ; time.Sleep(time.Millisecond) {
+		if locked = s.mu.TryLock(); locked || time.Now().After(deadline) {
+			break
+		}
+	}
+	if locked {
+		defer s.mu.Unlock()
+	}
+
+	if err := s.finishLocked(StatusPanicked); err != nil {
+		s.log.E("Failed to finalize benchmark files: %v", err)
+	}
+}
+
+// reraise delivers sig again with this handler removed, so the default action (usually exit) applies.
+//
+// Handlers registered by the program receive it again. Exits if the signal cannot be sent.
+func reraise(sig os.Signal) {
+	p, err := os.FindProcess(os.Getpid())
+	if err == nil {
+		err = p.Signal(sig)
+	}
+	if err != nil {
+		os.Exit(1)
+	}
+}
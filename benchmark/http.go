@@ -0,0 +1,78 @@
+package benchmark
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/pprof"
+	"strconv"
+	"time"
+)
+
+// Handler returns an http.Handler exposing profiling window controls.
+//
+// Routes:
+//
+//	GET  /benchmark/window                 Window status.
+//	POST /benchmark/window/start?seconds=N Start a window (DefaultWindowDuration if unset).
+//	POST /benchmark/window/stop            Stop the running window.
+//
+// If exposePprof is set, the standard net/http/pprof endpoints are also served under /debug/pprof/.
+func (c *WindowController) Handler(exposePprof bool) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /benchmark/window", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusOK, c.Status())
+	})
+
+	mux.HandleFunc("POST /benchmark/window/start", func(w http.ResponseWriter, r *http.Request) {
+		var d time.Duration
+		if s := r.URL.Query().Get("seconds"); s != "" {
+			secs, err := strconv.Atoi(s)
+			if err != nil || secs <= 0 {
+				http.Error(w, "seconds must be a positive integer", http.StatusBadRequest)
+				return
+			}
+			d = time.Duration(secs) * time.Second
+		}
+
+		if _, err := c.Start(d); err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		writeJSON(w, http.StatusAccepted, c.Status())
+	})
+
+	mux.HandleFunc("POST /benchmark/window/stop", func(w http.ResponseWriter, _ *http.Request) {
+		if err := c.Stop(); err != nil {
+			http.Error(w, err.Error(), errorStatus(err))
+			return
+		}
+		writeJSON(w, http.StatusOK, c.Status())
+	})
+
+	if exposePprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+
+	return mux
+}
+
+// errorStatus returns the HTTP status for a window error, a conflict if a window is or is not running.
+func errorStatus(err error) int {
+	if errors.Is(err, ErrSessionState) {
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// writeJSON writes v as a JSON response.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
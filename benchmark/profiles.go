@@ -0,0 +1,199 @@
+package benchmark
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"sync"
+)
+
+// Profile is a type of profile collected by a benchmark session.
+type Profile string
+
+// Profile types.
+const (
+	ProfileCPU          Profile = "cpu"
+	ProfileHeap         Profile = "heap"
+	ProfileTrace        Profile = "trace"
+	ProfileBlock        Profile = "block"
+	ProfileMutex        Profile = "mutex"
+	ProfileGoroutine    Profile = "goroutine"
+	ProfileThreadCreate Profile = "threadcreate"
+	ProfileAllocs       Profile = "allocs"
+)
+
+// ValidProfiles contains the profile types a session can collect.
+var ValidProfiles = map[Profile]struct{}{
+	ProfileCPU:          {},
+	ProfileHeap:         {},
+	ProfileTrace:        {},
+	ProfileBlock:        {},
+	ProfileMutex:        {},
+	ProfileGoroutine:    {},
+	ProfileThreadCreate: {},
+	ProfileAllocs:       {},
+}
+
+// DefaultProfiles are collected when no profiles are requested.
+var DefaultProfiles = []Profile{ProfileCPU, ProfileHeap, ProfileTrace}
+
+// Default sampling rates, matching "go test -blockprofile" and "-mutexprofile" (record every event).
+const (
+	DefaultBlockProfileRate     = 1
+	DefaultMutexProfileFraction = 1
+)
+
+// profileOrder is the order profiles are started in (and stopped in reverse).
+var profileOrder = []Profile{
+	ProfileGoroutine,
+	ProfileThreadCreate,
+	ProfileAllocs,
+	ProfileHeap,
+	ProfileBlock,
+	ProfileMutex,
+	ProfileTrace,
+	ProfileCPU,
+}
+
+// profileFiles maps profile types to their filenames in the run directory.
+var profileFiles = map[Profile]string{
+	ProfileCPU:          "cpu.prof",
+	ProfileHeap:         "mem.prof",
+	ProfileTrace:        "trace.out",
+	ProfileBlock:        "block.prof",
+	ProfileMutex:        "mutex.prof",
+	ProfileGoroutine:    "goroutine.prof",
+	ProfileThreadCreate: "threadcreate.prof",
+	ProfileAllocs:       "allocs.prof",
+}
+
+// Process-wide profiler state. CPU profiles and traces have one collector at a time, and the
+// runtime cannot report the block profile rate.
+var (
+	profilerMu    sync.Mutex
+	profilerOwner = make(map[Profile]*Session) // Sessions collecting exclusive profiles.
+	blockRate     int                          // Rate last set by a session, 0 is the runtime default.
+)
+
+// isExclusive returns true for profiles only one session can collect at a time.
+func isExclusive(p Profile) bool {
+	return p == ProfileCPU || p == ProfileTrace
+}
+
+// claimProfiles reserves the session's exclusive profiles, or returns an ErrSessionState error if
+// another session (or, for traces, other code) is collecting one.
+func (s *Session) claimProfiles() error {
+	profilerMu.Lock()
+	defer profilerMu.Unlock()
+
+	for _, p := range s.opts.Profiles {
+		if !isExclusive(p) {
+			continue
+		}
+		if owner := profilerOwner[p]; owner != nil && owner != s {
+			return stateError(fmt.Sprintf("%s profile already collected by another session", p))
+		}
+		if p == ProfileTrace && trace.IsEnabled() {
+			return stateError("execution trace already running")
+		}
+	}
+	for _, p := range s.opts.Profiles {
+		if isExclusive(p) {
+			profilerOwner[p] = s
+		}
+	}
+	return nil
+}
+
+// releaseProfiles frees the exclusive profiles reserved by the session.
+func (s *Session) releaseProfiles() {
+	profilerMu.Lock()
+	defer profilerMu.Unlock()
+
+	for p, owner := range profilerOwner {
+		if owner == s {
+			delete(profilerOwner, p)
+		}
+	}
+}
+
+// setBlockProfileRate sets the runtime block profile rate, returning the rate previously set by a session.
+func setBlockProfileRate(rate int) (prev int) {
+	profilerMu.Lock()
+	defer profilerMu.Unlock()
+
+	prev, blockRate = blockRate, rate
+	runtime.SetBlockProfileRate(rate)
+	return prev
+}
+
+// isContinuous returns true for profiles recorded between start and stop, rather than snapshotted on stop.
+func isContinuous(p Profile) bool {
+	switch p {
+	case ProfileCPU, ProfileTrace, ProfileBlock, ProfileMutex:
+		return true
+	default:
+		return false
+	}
+}
+
+// startProfile starts a continuous profile. Snapshot profiles are written on stop.
+func (s *Session) startProfile(p Profile, f *os.File) error {
+	switch p {
+	case ProfileCPU:
+		return pprof.StartCPUProfile(f)
+	case ProfileTrace:
+		return trace.Start(f)
+	case ProfileBlock:
+		s.prevBlockRate = setBlockProfileRate(s.opts.BlockProfileRate)
+		s.manifest.BlockProfileRate = s.opts.BlockProfileRate
+	case ProfileMutex:
+		s.prevMutexFraction = runtime.SetMutexProfileFraction(s.opts.MutexProfileFraction)
+		s.manifest.MutexProfileFraction = s.opts.MutexProfileFraction
+	}
+	return nil
+}
+
+// stopProfile stops a continuous profile and writes profile data if requested.
+func (s *Session) stopProfile(p Profile, f *os.File, write bool) error {
+	switch p {
+	case ProfileCPU:
+		s.log.I("Stopping CPU profile...")
+		pprof.StopCPUProfile()
+		return nil
+	case ProfileTrace:
+		s.log.I("Stopping trace...")
+		trace.Stop()
+		return nil
+	case ProfileBlock:
+		defer setBlockProfileRate(s.prevBlockRate)
+	case ProfileMutex:
+		defer runtime.SetMutexProfileFraction(s.prevMutexFraction)
+	}
+
+	if !write {
+		return nil
+	}
+
+	// Snapshot profiles.
+	if p == ProfileHeap {
+		s.log.I("Writing memory profile...")
+		runtime.GC()
+		if err := pprof.WriteHeapProfile(f); err != nil {
+			return fmt.Errorf("could not write memory profile: %w", err)
+		}
+		return nil
+	}
+
+	s.log.I("Writing %s profile...", p)
+	prof := pprof.Lookup(string(p))
+	if prof == nil {
+		return fmt.Errorf("no runtime profile named %q", p)
+	}
+	if err := prof.WriteTo(f, 0); err != nil {
+		return fmt.Errorf("could not write %s profile: %w", p, err)
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package benchmark
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/TubarrApp/gocommon/sharedconsts"
+)
+
+// resultsFile is the benchstat-compatible results filename in the run directory.
+const resultsFile = "bench.txt"
+
+// Measurement is a named result recorded into a session.
+//
+// Written on stop in "go test -bench" format, so runs can be compared with benchstat.
+type Measurement struct {
+	N          int                // Operations measured (e.g. files processed), treated as 1 if 0.
+	Duration   time.Duration      // Total wall time, reported as ns/op.
+	Bytes      int64              // Total bytes processed, reported as MB/s if set.
+	AllocBytes uint64             // Total bytes allocated, reported as B/op if set.
+	Allocs     uint64             // Total allocations, reported as allocs/op if set.
+	Metrics    map[string]float64 // Extra values by unit, e.g. {"files": 120}, written as-is.
+}
+
+// result is a recorded measurement.
+type result struct {
+	name string
+	m    Measurement
+}
+
+// Record adds a measurement to the session results. Repeated names are written as repeated samples.
+//
+// Names are written as benchstat-safe identifiers, e.g. "encode files" as BenchmarkEncode_files.
+func (s *Session) Record(name string, m Measurement) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.results = append(s.results, result{name: name, m: m})
+}
+
+// Measure runs fn, recording its wall time and allocations as a measurement for n operations over the given bytes.
+func (s *Session) Measure(name string, n int, bytes int64, fn func()) Measurement {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+
+	fn()
+
+	d := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	m := Measurement{
+		N:          n,
+		Duration:   d,
+		Bytes:      bytes,
+		AllocBytes: after.TotalAlloc - before.TotalAlloc,
+		Allocs:     after.Mallocs - before.Mallocs,
+	}
+	s.Record(name, m)
+	return m
+}
+
+// writeResults writes recorded measurements into the run directory.
+func (s *Session) writeResults() error {
+	path := filepath.Join(s.runDir, resultsFile)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, sharedconsts.PermsLogFile)
+	if err != nil {
+		return fmt.Errorf("could not create benchmark results: %w", err)
+	}
+
+	if err := writeBenchFormat(f, s.manifest.Program, s.results); err != nil {
+		f.Close()
+		return fmt.Errorf("could not write benchmark results %q: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close file %q: %w", path, err)
+	}
+	return nil
+}
+
+// writeBenchFormat writes results in "go test -bench" text format.
+func writeBenchFormat(w io.Writer, program string, results []result) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "goos: %s\ngoarch: %s\n", runtime.GOOS, runtime.GOARCH)
+	if program != "" {
+		fmt.Fprintf(&b, "pkg: %s\n", program)
+	}
+
+	procs := runtime.GOMAXPROCS(0)
+	for _, r := range results {
+		m := r.m
+		n := max(m.N, 1)
+
+		fmt.Fprintf(&b, "%s-%d\t%d\t%s ns/op", benchName(r.name), procs, n, formatFloat(float64(m.Duration.Nanoseconds())/float64(n)))
+
+		if m.Bytes > 0 && m.Duration > 0 {
+			fmt.Fprintf(&b, "\t%.2f MB/s", float64(m.Bytes)/1e6/m.Duration.Seconds())
+		}
+		if m.AllocBytes > 0 {
+			fmt.Fprintf(&b, "\t%d B/op", m.AllocBytes/uint64(n))
+		}
+		if m.Allocs > 0 {
+			fmt.Fprintf(&b, "\t%d allocs/op", m.Allocs/uint64(n))
+		}
+		for _, unit := range slices.Sorted(maps.Keys(m.Metrics)) {
+			fmt.Fprintf(&b, "\t%s %s", formatFloat(m.Metrics[unit]), benchUnit(unit))
+		}
+		b.WriteByte('\n')
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// benchName returns a benchstat-compatible benchmark name.
+//
+// Characters other than ASCII letters, digits and '_' are replaced with '_', since benchstat reads
+// '-' as the GOMAXPROCS suffix and whitespace as a field separator. E.g. "encode files-hevc" becomes
+// "BenchmarkEncode_files_hevc".
+func benchName(name string) string {
+	var b strings.Builder
+	sep := false
+	for _, r := range name {
+		if r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			if sep && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+			sep = false
+			continue
+		}
+		sep = true
+	}
+
+	name = b.String()
+	switch {
+	case name == "":
+		return "BenchmarkUnnamed"
+	case strings.HasPrefix(name, "Benchmark"):
+		return name
+	default:
+		return "Benchmark" + strings.ToUpper(name[:1]) + name[1:]
+	}
+}
+
+// benchUnit returns a unit without whitespace.
+func benchUnit(unit string) string {
+	return strings.Join(strings.Fields(unit), "_")
+}
+
+// formatFloat formats values the way the testing package does (integers without decimals).
+func formatFloat(v float64) string {
+	if v == float64(int64(v)) {
+		return strconv.FormatInt(int64(v), 10)
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
@@ -0,0 +1,303 @@
+package benchmark
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime/metrics"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/TubarrApp/gocommon/logging"
+)
+
+// Runtime stats sample formats.
+const (
+	SampleFormatJSONL = "jsonl"
+	SampleFormatCSV   = "csv"
+)
+
+// Runtime metric names read by the sampler.
+const (
+	metricHeapObjects  = "/memory/classes/heap/objects:bytes"
+	metricGoroutines   = "/sched/goroutines:goroutines"
+	metricGCCycles     = "/gc/cycles/total:gc-cycles"
+	metricGCPauses     = "/sched/pauses/total/gc:seconds"
+	metricSchedLatency = "/sched/latencies:seconds"
+)
+
+// runtimeStatsFile is the sample filename in the run directory, without extension.
+const runtimeStatsFile = "runtime_stats"
+
+// RuntimeSample is a single reading of runtime metrics.
+//
+// Percentiles cover the session so far, not just the last interval.
+type RuntimeSample struct {
+	Time             time.Time `json:"time"`
+	HeapInUseBytes   uint64    `json:"heap_inuse_bytes"`
+	Goroutines       uint64    `json:"goroutines"`
+	GCCycles         uint64    `json:"gc_cycles"`
+	GCPauseP99       float64   `json:"gc_pause_p99_seconds"`
+	SchedLatencyP99  float64   `json:"sched_latency_p99_seconds"`
+	SchedLatencyMean float64   `json:"sched_latency_mean_seconds"`
+}
+
+// RuntimeSummary summarizes the runtime samples of a session.
+type RuntimeSummary struct {
+	Samples         int     `json:"samples"`
+	PeakHeapBytes   uint64  `json:"peak_heap_bytes"`
+	PeakGoroutines  uint64  `json:"peak_goroutines"`
+	GCCycles        uint64  `json:"gc_cycles"`
+	GCPauseP99      float64 `json:"gc_pause_p99_seconds"`
+	SchedLatencyP99 float64 `json:"sched_latency_p99_seconds"`
+}
+
+// sampler periodically reads runtime metrics into the run directory.
+type sampler struct {
+	log      *logging.ProgramLogger
+	interval time.Duration
+	file     *os.File
+	write    func(RuntimeSample) error
+
+	samples    []metrics.Sample
+	startGC    uint64
+	startPause metrics.Float64Histogram
+	startLat   metrics.Float64Histogram
+
+	mu      sync.Mutex
+	summary RuntimeSummary
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newSampler creates the sample file in the run directory.
+func newSampler(log *logging.ProgramLogger, runDir string, interval time.Duration, format string) (*sampler, string, error) {
+	if format == "" {
+		format = SampleFormatJSONL
+	}
+	if format != SampleFormatJSONL && format != SampleFormatCSV {
+		return nil, "", fmt.Errorf("runtime stats format %q is not valid", format)
+	}
+
+	name := runtimeStatsFile + "." + format
+	f, err := os.Create(filepath.Join(runDir, name))
+	if err != nil {
+		return nil, "", fmt.Errorf("could not create runtime stats file: %w", err)
+	}
+
+	sm := &sampler{
+		log:      log,
+		interval: interval,
+		file:     f,
+		samples: []metrics.Sample{
+			{Name: metricHeapObjects},
+			{Name: metricGoroutines},
+			{Name: metricGCCycles},
+			{Name: metricGCPauses},
+			{Name: metricSchedLatency},
+		},
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+
+	if format == SampleFormatCSV {
+		sm.write, err = csvSampleWriter(f)
+	} else {
+		sm.write = jsonSampleWriter(f)
+	}
+	if err != nil {
+		f.Close()
+		return nil, "", err
+	}
+
+	// Baseline for session-relative values.
+	metrics.Read(sm.samples)
+	sm.startGC = sm.samples[2].Value.Uint64()
+	sm.startPause = copyHistogram(sm.samples[3].Value.Float64Histogram())
+	sm.startLat = copyHistogram(sm.samples[4].Value.Float64Histogram())
+
+	return sm, name, nil
+}
+
+// start begins sampling in the background.
+func (sm *sampler) start() {
+	sm.log.Go(func() {
+		defer close(sm.done)
+
+		ticker := time.NewTicker(sm.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				sm.sample()
+			case <-sm.stop:
+				return
+			}
+		}
+	})
+}
+
+// finish stops sampling, takes a final sample and closes the file.
+func (sm *sampler) finish() (RuntimeSummary, error) {
+	close(sm.stop)
+	<-sm.done
+
+	sm.sample()
+
+	sm.mu.Lock()
+	summary := sm.summary
+	sm.mu.Unlock()
+
+	if err := sm.file.Close(); err != nil {
+		return summary, fmt.Errorf("failed to close file %q: %w", sm.file.Name(), err)
+	}
+	return summary, nil
+}
+
+// discard closes the file of a sampler that was never started.
+func (sm *sampler) discard() {
+	_ = sm.file.Close()
+}
+
+// sample reads and writes one sample, updating the summary.
+func (sm *sampler) sample() {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	metrics.Read(sm.samples)
+
+	pauses := subHistogram(sm.samples[3].Value.Float64Histogram(), sm.startPause)
+	lat := subHistogram(sm.samples[4].Value.Float64Histogram(), sm.startLat)
+
+	s := RuntimeSample{
+		Time:             time.Now(),
+		HeapInUseBytes:   sm.samples[0].Value.Uint64(),
+		Goroutines:       sm.samples[1].Value.Uint64(),
+		GCCycles:         sm.samples[2].Value.Uint64() - sm.startGC,
+		GCPauseP99:       histogramPercentile(pauses, 0.99),
+		SchedLatencyP99:  histogramPercentile(lat, 0.99),
+		SchedLatencyMean: histogramMean(lat),
+	}
+
+	sm.summary.Samples++
+	sm.summary.PeakHeapBytes = max(sm.summary.PeakHeapBytes, s.HeapInUseBytes)
+	sm.summary.PeakGoroutines = max(sm.summary.PeakGoroutines, s.Goroutines)
+	sm.summary.GCCycles = s.GCCycles
+	sm.summary.GCPauseP99 = s.GCPauseP99
+	sm.summary.SchedLatencyP99 = s.SchedLatencyP99
+
+	if err := sm.write(s); err != nil {
+		sm.log.W("Could not write runtime stats sample: %v", err)
+	}
+}
+
+// jsonSampleWriter writes one JSON object per line.
+func jsonSampleWriter(w io.Writer) func(RuntimeSample) error {
+	enc := json.NewEncoder(w)
+	return func(s RuntimeSample) error {
+		return enc.Encode(s)
+	}
+}
+
+// csvSampleWriter writes a header, then one row per sample.
+func csvSampleWriter(w io.Writer) (func(RuntimeSample) error, error) {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{
+		"time", "heap_inuse_bytes", "goroutines", "gc_cycles",
+		"gc_pause_p99_seconds", "sched_latency_p99_seconds", "sched_latency_mean_seconds",
+	}); err != nil {
+		return nil, fmt.Errorf("could not write runtime stats header: %w", err)
+	}
+	cw.Flush()
+
+	return func(s RuntimeSample) error {
+		if err := cw.Write([]string{
+			s.Time.Format(time.RFC3339Nano),
+			strconv.FormatUint(s.HeapInUseBytes, 10),
+			strconv.FormatUint(s.Goroutines, 10),
+			strconv.FormatUint(s.GCCycles, 10),
+			strconv.FormatFloat(s.GCPauseP99, 'g', -1, 64),
+			strconv.FormatFloat(s.SchedLatencyP99, 'g', -1, 64),
+			strconv.FormatFloat(s.SchedLatencyMean, 'g', -1, 64),
+		}); err != nil {
+			return err
+		}
+		cw.Flush()
+		return cw.Error()
+	}, nil
+}
+
+// copyHistogram copies a histogram, metrics.Read reuses the original's memory.
+func copyHistogram(h *metrics.Float64Histogram) metrics.Float64Histogram {
+	return metrics.Float64Histogram{
+		Counts:  append([]uint64(nil), h.Counts...),
+		Buckets: append([]float64(nil), h.Buckets...),
+	}
+}
+
+// subHistogram returns the counts recorded since the baseline.
+func subHistogram(h *metrics.Float64Histogram, base metrics.Float64Histogram) metrics.Float64Histogram {
+	out := copyHistogram(h)
+	if len(base.Counts) != len(out.Counts) {
+		return out
+	}
+	for i := range out.Counts {
+		out.Counts[i] -= min(base.Counts[i], out.Counts[i])
+	}
+	return out
+}
+
+// histogramPercentile returns the upper bound of the bucket containing quantile q.
+func histogramPercentile(h metrics.Float64Histogram, q float64) float64 {
+	var total uint64
+	for _, c := range h.Counts {
+		total += c
+	}
+	if total == 0 {
+		return 0
+	}
+
+	target := uint64(math.Ceil(float64(total) * q))
+	var cum uint64
+	for i, c := range h.Counts {
+		cum += c
+		if cum >= target {
+			if upper := h.Buckets[i+1]; !math.IsInf(upper, 1) {
+				return upper
+			}
+			return h.Buckets[i]
+		}
+	}
+	return h.Buckets[len(h.Buckets)-1]
+}
+
+// histogramMean returns the approximate mean using bucket midpoints.
+func histogramMean(h metrics.Float64Histogram) float64 {
+	var total uint64
+	var sum float64
+	for i, c := range h.Counts {
+		if c == 0 {
+			continue
+		}
+		lo, hi := h.Buckets[i], h.Buckets[i+1]
+		if math.IsInf(lo, -1) {
+			lo = hi
+		}
+		if math.IsInf(hi, 1) {
+			hi = lo
+		}
+		total += c
+		sum += float64(c) * (lo + hi) / 2
+	}
+	if total == 0 {
+		return 0
+	}
+	return sum / float64(total)
+}
@@ -0,0 +1,419 @@
+package benchmark
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/TubarrApp/gocommon/logging"
+	"github.com/TubarrApp/gocommon/sharedconsts"
+)
+
+// Run directory constants.
+const (
+	runTimeFormat = "2006-01-02_15-04-05"
+	manifestFile  = "manifest.json"
+)
+
+// Options configure a benchmark session.
+type Options struct {
+	Dir      string    // Base directory, each run is written to a timestamped subdirectory.
+	Name     string    // Optional run name, prefixed to the run directory.
+	Profiles []Profile // Profiles to collect (DefaultProfiles if empty).
+
+	BlockProfileRate     int // Nanoseconds blocked per sampled event for ProfileBlock (DefaultBlockProfileRate if 0).
+	MutexProfileFraction int // On average 1/n contention events are sampled for ProfileMutex (DefaultMutexProfileFraction if 0).
+	MemProfileRate       int // Bytes allocated per sampled allocation, sets runtime.MemProfileRate for the session if above 0.
+
+	SampleInterval time.Duration // Runtime stats sampling interval, 0 disables sampling.
+	SampleFormat   string        // SampleFormatJSONL (default) or SampleFormatCSV.
+
+	// HandleSignals finalizes the run on SIGINT or SIGTERM. The program's own handlers still
+	// receive the signal, and should exit. Programs without handlers should set ReraiseSignals,
+	// or they keep running after the signal.
+	HandleSignals bool
+	// ReraiseSignals re-raises the signal after finalizing, so its default action (exit) applies.
+	// Set only if the program does not handle these signals itself, or its handlers receive them twice.
+	ReraiseSignals bool
+	// HandlePanics finalizes the run when the logger's Recover handles a fatal (re-raised) panic.
+	// Recovered panics the program continues after mark the run as panicked.
+	HandlePanics bool
+}
+
+// Manifest lists the files written by a session. Written as manifest.json in the run directory.
+type Manifest struct {
+	Name      string         `json:"name,omitempty"`
+	Program   string         `json:"program,omitempty"`
+	Status    RunStatus      `json:"status"`
+	Started   time.Time      `json:"started"`
+	Stopped   time.Time      `json:"stopped,omitzero"`
+	GoVersion string         `json:"go_version"`
+	GOOS      string         `json:"goos"`
+	GOARCH    string         `json:"goarch"`
+	Files     []ManifestFile `json:"files"`
+
+	BlockProfileRate     int `json:"block_profile_rate,omitempty"`
+	MutexProfileFraction int `json:"mutex_profile_fraction,omitempty"`
+	MemProfileRate       int `json:"mem_profile_rate"`
+
+	RuntimeStats *RuntimeSummary `json:"runtime_stats,omitempty"`
+}
+
+// ManifestFile is a single file written by a session.
+type ManifestFile struct {
+	Profile Profile `json:"profile,omitempty"`
+	Path    string  `json:"path"` // Relative to the run directory.
+}
+
+// ErrSessionState is returned when a session is started or stopped out of order.
+var ErrSessionState = errors.New("benchmark session state")
+
+// Session is a single benchmarking run, collecting profiles into its own run directory.
+type Session struct {
+	log  *logging.ProgramLogger
+	opts Options
+
+	mu       sync.Mutex
+	runDir   string
+	files    map[Profile]*os.File
+	running  map[Profile]bool // Started continuous profiles.
+	manifest Manifest
+
+	prevBlockRate     int // Restored when the block profile stops.
+	prevMutexFraction int // Restored when the mutex profile stops.
+	prevMemRate       int // Restored when profiling stops, 0 if unchanged.
+	sampler           *sampler
+	spans             *spanRecorder
+	results           []result
+	started           bool
+	stopped           bool
+
+	// Crash handling.
+	signals         chan os.Signal  // Receives finalize signals, notified by the OS if nil.
+	reraise         func(os.Signal) // Re-raises a finalize signal if ReraiseSignals is set.
+	finished        chan struct{}   // Closed when the session is finalized.
+	removePanicHook func()
+	panicked        atomic.Bool // Set without s.mu, a panic may be raised while it is held.
+}
+
+// NewSession validates the options and returns an unstarted session.
+func NewSession(log *logging.ProgramLogger, opts Options) (*Session, error) {
+	if opts.Dir == "" {
+		return nil, fmt.Errorf("benchmark directory is required")
+	}
+	if len(opts.Profiles) == 0 {
+		opts.Profiles = DefaultProfiles
+	}
+
+	// Check profiles, dropping duplicates.
+	seen := make(map[Profile]struct{}, len(opts.Profiles))
+	profiles := make([]Profile, 0, len(opts.Profiles))
+	for _, p := range opts.Profiles {
+		if _, ok := ValidProfiles[p]; !ok {
+			return nil, fmt.Errorf("profile type %q is not valid", p)
+		}
+		if _, dup := seen[p]; dup {
+			continue
+		}
+		seen[p] = struct{}{}
+		profiles = append(profiles, p)
+	}
+	opts.Profiles = profiles
+
+	// Sampling rates.
+	if opts.BlockProfileRate <= 0 {
+		opts.BlockProfileRate = DefaultBlockProfileRate
+	}
+	if opts.MutexProfileFraction <= 0 {
+		opts.MutexProfileFraction = DefaultMutexProfileFraction
+	}
+
+	// Runtime stats.
+	switch opts.SampleFormat {
+	case "", SampleFormatJSONL, SampleFormatCSV:
+	default:
+		return nil, fmt.Errorf("runtime stats format %q is not valid", opts.SampleFormat)
+	}
+
+	return &Session{
+		log:     log,
+		opts:    opts,
+		files:   make(map[Profile]*os.File, len(profiles)),
+		running: make(map[Profile]bool, len(profiles)),
+		reraise: reraise,
+	}, nil
+}
+
+// RunDir returns the run directory, empty until the session is started.
+func (s *Session) RunDir() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.runDir
+}
+
+// Start creates the run directory and profile files, then starts collecting.
+//
+// On failure, anything already started is stopped and closed. Returns an ErrSessionState error if
+// another session is collecting a CPU profile or trace this session requests.
+func (s *Session) Start() (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.started {
+		return stateError("session already started")
+	}
+	if err := s.claimProfiles(); err != nil {
+		return err
+	}
+	s.started = true
+
+	now := time.Now()
+	s.runDir, err = makeBenchFilepaths(s.opts.Dir, s.opts.Name, now)
+	if err != nil {
+		s.releaseProfiles()
+		return err
+	}
+
+	s.manifest = Manifest{
+		Name:      s.opts.Name,
+		Program:   s.log.Program,
+		Status:    StatusRunning,
+		Started:   now,
+		GoVersion: runtime.Version(),
+		GOOS:      runtime.GOOS,
+		GOARCH:    runtime.GOARCH,
+	}
+
+	// Must be set before the allocations of interest.
+	if s.opts.MemProfileRate > 0 {
+		s.prevMemRate = runtime.MemProfileRate
+		runtime.MemProfileRate = s.opts.MemProfileRate
+	}
+	s.manifest.MemProfileRate = runtime.MemProfileRate
+
+	s.log.I("Created benchmark directory: %q", s.runDir)
+	s.log.I("(Benchmarking this run. Start time: %s)", now.Format(runTimeFormat))
+
+	// Clean up on failure.
+	defer func() {
+		if err != nil {
+			s.stopped = true
+			if stopErr := s.stopProfiles(false); stopErr != nil {
+				err = errors.Join(err, stopErr)
+			}
+			if s.sampler != nil {
+				s.sampler.discard()
+				s.sampler = nil
+			}
+		}
+	}()
+
+	// Create all files first, so a bad directory fails before profiling starts.
+	for _, p := range s.opts.Profiles {
+		path := filepath.Join(s.runDir, profileFiles[p])
+		f, err := os.Create(path)
+		if err != nil {
+			return fmt.Errorf("could not create %s profiling file: %w", p, err)
+		}
+		s.files[p] = f
+		s.manifest.Files = append(s.manifest.Files, ManifestFile{Profile: p, Path: profileFiles[p]})
+	}
+
+	for _, p := range profileOrder {
+		f, ok := s.files[p]
+		if !ok {
+			continue
+		}
+		if err := s.startProfile(p, f); err != nil {
+			return fmt.Errorf("could not start %s profiling: %w", p, err)
+		}
+		s.running[p] = true
+	}
+
+	// The sample file is listed in the manifest, but sampling starts once nothing else can fail.
+	if s.opts.SampleInterval > 0 {
+		sm, name, err := newSampler(s.log, s.runDir, s.opts.SampleInterval, s.opts.SampleFormat)
+		if err != nil {
+			return err
+		}
+		s.sampler = sm
+		s.manifest.Files = append(s.manifest.Files, ManifestFile{Path: name})
+	}
+
+	// Written now so killed runs are identifiable.
+	if err := s.writeManifest(); err != nil {
+		return err
+	}
+
+	if s.sampler != nil {
+		s.sampler.start()
+	}
+
+	s.spans = newSpanRecorder()
+	s.startCrashHandling()
+	return nil
+}
+
+// Stop stops collecting, writes snapshot profiles, closes files and writes the manifest.
+//
+// Calling Stop more than once is a no-op.
+func (s *Session) Stop() error {
+	return s.finish(StatusComplete)
+}
+
+// finish finalizes the session, recording status in the manifest.
+func (s *Session) finish(status RunStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.finishLocked(status)
+}
+
+// finishLocked is finish for callers holding s.mu.
+func (s *Session) finishLocked(status RunStatus) error {
+	if !s.started {
+		return stateError("session not started")
+	}
+	if s.stopped {
+		return nil
+	}
+	s.stopped = true
+	s.stopCrashHandling()
+
+	if status == StatusComplete && s.panicked.Load() {
+		status = StatusPanicked
+	}
+
+	var errs []error
+	if s.sampler != nil {
+		summary, err := s.sampler.finish()
+		if err != nil {
+			errs = append(errs, err)
+		}
+		s.manifest.RuntimeStats = &summary
+		s.log.I("Runtime stats: %d samples, peak heap %s, peak goroutines %d, %d GC cycles, GC pause p99 %s, scheduler latency p99 %s",
+			summary.Samples,
+			formatBytes(int64(summary.PeakHeapBytes)),
+			summary.PeakGoroutines,
+			summary.GCCycles,
+			secondsToDuration(summary.GCPauseP99),
+			secondsToDuration(summary.SchedLatencyP99))
+	}
+
+	// Span summary.
+	if s.spans != nil {
+		s.spans.close()
+		if !s.spans.empty() {
+			if err := s.spans.writeFile(s.runDir); err != nil {
+				errs = append(errs, err)
+			} else {
+				s.manifest.Files = append(s.manifest.Files, ManifestFile{Path: spansFile})
+			}
+		}
+	}
+
+	// Recorded measurements.
+	if len(s.results) > 0 {
+		if err := s.writeResults(); err != nil {
+			errs = append(errs, err)
+		} else {
+			s.manifest.Files = append(s.manifest.Files, ManifestFile{Path: resultsFile})
+		}
+	}
+
+	err := errors.Join(append(errs, s.stopProfiles(true))...)
+	s.manifest.Status = status
+	s.manifest.Stopped = time.Now()
+	if manifestErr := s.writeManifest(); manifestErr != nil {
+		err = errors.Join(err, manifestErr)
+	}
+
+	s.log.I("Benchmark files written to %q", s.runDir)
+	return err
+}
+
+// stopProfiles stops running profiles, writes snapshot profiles if requested and closes all files.
+func (s *Session) stopProfiles(writeSnapshots bool) error {
+	var errs []error
+
+	for i := len(profileOrder) - 1; i >= 0; i-- {
+		p := profileOrder[i]
+		f, ok := s.files[p]
+		if !ok || f == nil {
+			continue
+		}
+
+		if s.running[p] || !isContinuous(p) {
+			if err := s.stopProfile(p, f, writeSnapshots); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		s.running[p] = false
+		if err := f.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close file %q: %w", f.Name(), err))
+		}
+		s.files[p] = nil // Prevent double-close.
+	}
+
+	// After the heap profile is written, so it is sampled at the session rate.
+	if s.prevMemRate > 0 {
+		runtime.MemProfileRate = s.prevMemRate
+		s.prevMemRate = 0
+	}
+	s.releaseProfiles()
+	return errors.Join(errs...)
+}
+
+// writeManifest writes the manifest JSON into the run directory.
+func (s *Session) writeManifest() error {
+	data, err := json.MarshalIndent(s.manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode benchmark manifest: %w", err)
+	}
+
+	path := filepath.Join(s.runDir, manifestFile)
+	if err := os.WriteFile(path, data, sharedconsts.PermsLogFile); err != nil {
+		return fmt.Errorf("could not write benchmark manifest %q: %w", path, err)
+	}
+	return nil
+}
+
+// secondsToDuration converts runtime/metrics seconds to a duration.
+func secondsToDuration(sec float64) time.Duration {
+	return time.Duration(sec * float64(time.Second))
+}
+
+// stateError returns an ErrSessionState error with details.
+func stateError(msg string) error {
+	return fmt.Errorf("%w: %s", ErrSessionState, msg)
+}
+
+// makeBenchFilepaths makes a unique timestamped run directory for benchmarking files.
+func makeBenchFilepaths(baseDir, name string, t time.Time) (string, error) {
+	if err := os.MkdirAll(baseDir, sharedconsts.PermsGenericDir); err != nil {
+		return "", fmt.Errorf("failed to create benchmark directory %q: %w", baseDir, err)
+	}
+
+	runName := t.Format(runTimeFormat)
+	if name != "" {
+		runName = name + "_" + runName
+	}
+
+	// Suffix the name if a run already started this second.
+	runDir := filepath.Join(baseDir, runName)
+	for i := 2; ; i++ {
+		err := os.Mkdir(runDir, sharedconsts.PermsGenericDir)
+		if err == nil {
+			return runDir, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return "", fmt.Errorf("failed to create benchmark run directory %q: %w", runDir, err)
+		}
+		runDir = filepath.Join(baseDir, fmt.Sprintf("%s_%d", runName, i))
+	}
+}
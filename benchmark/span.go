@@ -0,0 +1,246 @@
+package benchmark
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"runtime/trace"
+	"slices"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/TubarrApp/gocommon/sharedconsts"
+)
+
+// spansFile is the span summary filename in the run directory.
+const spansFile = "spans.txt"
+
+// Attr is a key/value annotation logged into the execution trace for a span.
+type Attr struct {
+	Key   string
+	Value any
+}
+
+// NewAttr returns a span annotation.
+func NewAttr(key string, value any) Attr {
+	return Attr{Key: key, Value: value}
+}
+
+// SpanHandle is a running span. End it on the goroutine which started it.
+type SpanHandle struct {
+	name   string
+	start  time.Time
+	task   *trace.Task
+	region *trace.Region
+	once   sync.Once
+}
+
+// Span starts a named span, creating a runtime/trace task and region with the attributes logged.
+//
+// Durations are recorded per span name into every running session, which writes a summary table
+// into its run directory on stop. Usage:
+//
+//	ctx, span := benchmark.Span(ctx, "transcode", benchmark.NewAttr("file", name))
+//	defer span.End()
+func Span(ctx context.Context, name string, attrs ...Attr) (context.Context, *SpanHandle) {
+	ctx, task := trace.NewTask(ctx, name)
+	if trace.IsEnabled() {
+		for _, a := range attrs {
+			trace.Log(ctx, a.Key, fmt.Sprint(a.Value))
+		}
+	}
+
+	return ctx, &SpanHandle{
+		name:   name,
+		start:  time.Now(),
+		task:   task,
+		region: trace.StartRegion(ctx, name),
+	}
+}
+
+// End ends the span and records its duration. Calling End more than once is a no-op.
+func (sp *SpanHandle) End() time.Duration {
+	var d time.Duration
+	sp.once.Do(func() {
+		d = time.Since(sp.start)
+		sp.region.End()
+		sp.task.End()
+		recordSpan(sp.name, d)
+	})
+	return d
+}
+
+// **** Private **********************************************************************************
+
+// spanRecorders holds the recorders of running sessions.
+var spanRecorders struct {
+	mu   sync.RWMutex
+	list []*spanRecorder
+}
+
+// recordSpan adds a span duration to every running session.
+func recordSpan(name string, d time.Duration) {
+	spanRecorders.mu.RLock()
+	defer spanRecorders.mu.RUnlock()
+
+	for _, r := range spanRecorders.list {
+		r.record(name, d)
+	}
+}
+
+// spanRecorder collects span durations for one session.
+type spanRecorder struct {
+	mu    sync.Mutex
+	hists map[string]*spanHistogram
+}
+
+// newSpanRecorder registers a recorder for span durations.
+func newSpanRecorder() *spanRecorder {
+	r := &spanRecorder{hists: make(map[string]*spanHistogram)}
+
+	spanRecorders.mu.Lock()
+	spanRecorders.list = append(spanRecorders.list, r)
+	spanRecorders.mu.Unlock()
+
+	return r
+}
+
+// close unregisters the recorder.
+func (r *spanRecorder) close() {
+	spanRecorders.mu.Lock()
+	spanRecorders.list = slices.DeleteFunc(spanRecorders.list, func(other *spanRecorder) bool {
+		return other == r
+	})
+	spanRecorders.mu.Unlock()
+}
+
+// record adds a duration to the named histogram.
+func (r *spanRecorder) record(name string, d time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	h, ok := r.hists[name]
+	if !ok {
+		h = &spanHistogram{min: d}
+		r.hists[name] = h
+	}
+	h.add(d)
+}
+
+// empty returns true if no spans were recorded.
+func (r *spanRecorder) empty() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.hists) == 0
+}
+
+// writeFile writes the summary table into the run directory.
+func (r *spanRecorder) writeFile(runDir string) error {
+	path := filepath.Join(runDir, spansFile)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, sharedconsts.PermsLogFile)
+	if err != nil {
+		return fmt.Errorf("could not create span summary: %w", err)
+	}
+
+	if err := r.writeTable(f); err != nil {
+		f.Close()
+		return fmt.Errorf("could not write span summary %q: %w", path, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to close file %q: %w", path, err)
+	}
+	return nil
+}
+
+// writeTable writes one row per span name, largest total first.
+func (r *spanRecorder) writeTable(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	names := make([]string, 0, len(r.hists))
+	for name := range r.hists {
+		names = append(names, name)
+	}
+	slices.SortFunc(names, func(a, b string) int {
+		if c := cmp.Compare(r.hists[b].sum, r.hists[a].sum); c != 0 {
+			return c
+		}
+		return cmp.Compare(a, b)
+	})
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "span\tcount\ttotal\tmean\tmin\tp50\tp90\tp99\tmax")
+	for _, name := range names {
+		h := r.hists[name]
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			name, h.count,
+			roundDuration(h.sum),
+			roundDuration(h.sum/time.Duration(h.count)),
+			roundDuration(h.min),
+			roundDuration(h.percentile(0.50)),
+			roundDuration(h.percentile(0.90)),
+			roundDuration(h.percentile(0.99)),
+			roundDuration(h.max))
+	}
+	return tw.Flush()
+}
+
+// spanHistogram is a log2-bucketed duration histogram.
+//
+// Bucket i holds durations in [2^(i-1), 2^i) nanoseconds, so percentiles are within a factor of two.
+type spanHistogram struct {
+	buckets [64]uint64
+	count   uint64
+	sum     time.Duration
+	min     time.Duration
+	max     time.Duration
+}
+
+// add records one duration.
+func (h *spanHistogram) add(d time.Duration) {
+	h.buckets[bits.Len64(uint64(max(d, 0)))%64]++
+	h.count++
+	h.sum += d
+	h.min = min(h.min, d)
+	h.max = max(h.max, d)
+}
+
+// percentile returns the upper bound of the bucket containing quantile q, capped at the maximum.
+func (h *spanHistogram) percentile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+
+	target := uint64(float64(h.count)*q + 0.5)
+	target = max(target, 1)
+
+	var cum uint64
+	for i, c := range h.buckets {
+		cum += c
+		if cum >= target {
+			if i >= 63 {
+				return h.max
+			}
+			upper := time.Duration(1<<i - 1)
+			return min(max(upper, h.min), h.max)
+		}
+	}
+	return h.max
+}
+
+// roundDuration rounds durations for display.
+func roundDuration(d time.Duration) time.Duration {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond)
+	case d >= time.Millisecond:
+		return d.Round(time.Microsecond)
+	default:
+		return d
+	}
+}
@@ -0,0 +1,300 @@
+package logging
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Audit constants.
+const (
+	jHash    = "hash"
+	jGenesis = "genesis"
+
+	hashFieldPrefix = `"` + jHash + `":"`
+	genesisField    = `"` + jGenesis + `":true`
+	hashHexLen      = sha256.Size * 2
+
+	// Lumberjack backup timestamp layout, e.g. "tubarr-2006-01-02T15-04-05.000.log".
+	backupTimeFormat = "2006-01-02T15-04-05.000"
+)
+
+// auditChain links each JSON log line to the previous one.
+type auditChain struct {
+	mu   sync.Mutex
+	prev string // Hex hash of the previous line, empty at the start of a chain.
+}
+
+// link returns the line with a hash field appended and advances the chain.
+//
+// The hash is SHA-256 over the previous line's hash followed by the line without its hash field.
+// The first line of a chain is marked with a genesis field, so the verifier can tell it from a line
+// whose predecessor is missing.
+func (c *auditChain) link(p []byte) []byte {
+	body := bytes.TrimRight(p, "\n")
+	if len(body) < 2 || body[0] != '{' || body[len(body)-1] != '}' {
+		return p // Not a JSON object, leave for the verifier to report.
+	}
+	if c.prev == "" {
+		body = appendField(body, genesisField)
+	}
+
+	sum := chainHash(c.prev, body)
+	c.prev = sum
+
+	return append(appendField(body, hashFieldPrefix+sum+`"`), '\n')
+}
+
+// appendField returns a copy of the JSON object with the field inserted before the closing brace.
+func appendField(body []byte, field string) []byte {
+	out := make([]byte, 0, len(body)+len(field)+2)
+	out = append(out, body[:len(body)-1]...)
+	if len(body) > 2 { // Not "{}".
+		out = append(out, ',')
+	}
+	out = append(out, field...)
+	return append(out, '}')
+}
+
+// isGenesis returns true if the line body is the verified first line of a chain.
+func isGenesis(body []byte, hash string) bool {
+	return bytes.HasSuffix(body, []byte(genesisField+"}")) && chainHash("", body) == hash
+}
+
+// chainHash returns the hex chain hash for a line body.
+func chainHash(prev string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(prev))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// splitAuditLine separates a hashed JSON line into its original body and hash.
+func splitAuditLine(line []byte) (body []byte, hash string, ok bool) {
+	line = bytes.TrimRight(line, "\r\n")
+
+	// Line must end with: "hash":"<hex>"}
+	suffixLen := len(hashFieldPrefix) + hashHexLen + 2
+	if len(line) < suffixLen+1 || !bytes.HasSuffix(line, []byte(`"}`)) {
+		return nil, "", false
+	}
+	start := len(line) - suffixLen
+	if !bytes.HasPrefix(line[start:], []byte(hashFieldPrefix)) {
+		return nil, "", false
+	}
+	hash = string(line[start+len(hashFieldPrefix) : len(line)-2])
+
+	// Rebuild the original body.
+	head := line[:start]
+	switch {
+	case bytes.HasSuffix(head, []byte(",")):
+		head = head[:len(head)-1]
+	case !bytes.Equal(head, []byte("{")):
+		return nil, "", false
+	}
+	body = append(append([]byte(nil), head...), '}')
+	return body, hash, true
+}
+
+// AuditBreak records a line where the hash chain does not verify.
+type AuditBreak struct {
+	File   string
+	Line   int // 1-based line number within File.
+	Reason string
+}
+
+// AuditAnchor is how the first hashed line of an audit log was verified.
+type AuditAnchor string
+
+// Audit chain anchors.
+const (
+	AuditAnchorNone       AuditAnchor = "none"       // No hashed lines.
+	AuditAnchorGenesis    AuditAnchor = "genesis"    // The first line of the chain, verified.
+	AuditAnchorUnverified AuditAnchor = "unverified" // Its predecessor is missing, e.g. rotated away, or the line was altered.
+)
+
+// AuditReport is the result of walking the audit log chain.
+type AuditReport struct {
+	Files     []string // Files checked, oldest first.
+	Lines     int      // Total lines read.
+	Verified  int      // Lines whose hash matched the chain.
+	Unchained int      // Lines before the first hashed line (written before audit mode was enabled).
+	Anchor    AuditAnchor
+	Breaks    []AuditBreak
+}
+
+// OK returns true if no chain breaks were found.
+//
+// Lines are only verified back to the anchor. Check Anchor to tell whether the chain is complete.
+func (r *AuditReport) OK() bool {
+	return len(r.Breaks) == 0
+}
+
+// VerifyAuditLog walks the rotated backups and current log file oldest to newest, checking the hash chain.
+//
+// The first hashed line anchors the chain. It is verified if it is marked as the start of the chain,
+// otherwise it is trusted, reported as AuditAnchorUnverified and not counted as verified, since its
+// predecessor may have been rotated away. Every later line must carry a hash matching the previous
+// hash and its own content.
+func VerifyAuditLog(logFilePath string) (*AuditReport, error) {
+	backups, err := listBackups(logFilePath)
+	if err != nil {
+		return nil, err
+	}
+
+	files := backups
+	if _, err := os.Stat(logFilePath); err == nil {
+		files = append(files, logFilePath)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("could not stat log file %q: %w", logFilePath, err)
+	}
+
+	report := &AuditReport{Files: files, Anchor: AuditAnchorNone}
+	var (
+		prev    string
+		started bool
+	)
+
+	for _, path := range files {
+		err := scanLines(path, func(n int, line []byte) {
+			report.Lines++
+
+			body, hash, ok := splitAuditLine(line)
+			if !ok {
+				if !started {
+					report.Unchained++
+					return
+				}
+				report.Breaks = append(report.Breaks, AuditBreak{File: path, Line: n, Reason: "missing hash field"})
+				return
+			}
+
+			// Anchor the chain on the first hashed line.
+			if !started {
+				started = true
+				prev = hash
+				if isGenesis(body, hash) {
+					report.Anchor = AuditAnchorGenesis
+					report.Verified++
+				} else {
+					report.Anchor = AuditAnchorUnverified
+				}
+				return
+			}
+
+			switch {
+			case chainHash(prev, body) == hash:
+				report.Verified++
+			case isGenesis(body, hash):
+				report.Breaks = append(report.Breaks, AuditBreak{File: path, Line: n, Reason: "chain restarted, earlier lines were removed"})
+			default:
+				report.Breaks = append(report.Breaks, AuditBreak{File: path, Line: n, Reason: "hash does not match previous line and content"})
+			}
+			prev = hash // Continue from the stored hash so one edit reports one break.
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+// lastAuditHash returns the hash of the newest hashed line in the log file or its backups.
+func lastAuditHash(logFilePath string) (string, error) {
+	backups, err := listBackups(logFilePath)
+	if err != nil {
+		return "", err
+	}
+	files := append(backups, logFilePath)
+
+	// Newest first.
+	for i := len(files) - 1; i >= 0; i-- {
+		var last string
+		err := scanLines(files[i], func(_ int, line []byte) {
+			if _, hash, ok := splitAuditLine(line); ok {
+				last = hash
+			}
+		})
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+		if last != "" {
+			return last, nil
+		}
+	}
+	return "", nil
+}
+
+// listBackups returns lumberjack backups of the log file, oldest first.
+func listBackups(logFilePath string) ([]string, error) {
+	dir := filepath.Dir(logFilePath)
+	base := filepath.Base(logFilePath)
+	ext := filepath.Ext(base)
+	prefix := strings.TrimSuffix(base, ext) + "-"
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("could not read log directory %q: %w", dir, err)
+	}
+
+	type backup struct {
+		path string
+		t    time.Time
+	}
+	var backups []backup
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ext) {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ext)
+		t, err := time.Parse(backupTimeFormat, stamp)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, backup{path: filepath.Join(dir, name), t: t})
+	}
+
+	sort.Slice(backups, func(i, j int) bool { return backups[i].t.Before(backups[j].t) })
+
+	out := make([]string, 0, len(backups))
+	for _, b := range backups {
+		out = append(out, b.path)
+	}
+	return out, nil
+}
+
+// scanLines calls fn for each line in the file.
+func scanLines(path string, fn func(n int, line []byte)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	n := 0
+	for scanner.Scan() {
+		n++
+		fn(n, scanner.Bytes())
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error scanning log file %q: %w", path, err)
+	}
+	return nil
+}
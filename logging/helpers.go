@@ -30,10 +30,29 @@ func getCaller(skip int) callerInfo {
 type memoryWriter struct {
 	pl     *ProgramLogger
 	writer io.Writer
+	chain  *auditChain // Nil unless audit mode is enabled.
 }
 
 // Write writes the current JSON log line into RAM.
 func (mw *memoryWriter) Write(p []byte) (int, error) {
+	// Add hash chain field in audit mode.
+	if mw.chain != nil {
+		mw.chain.mu.Lock()
+		defer mw.chain.mu.Unlock()
+
+		n := len(p)
+		p = mw.chain.link(p)
+		if _, err := mw.write(p); err != nil {
+			return 0, err
+		}
+		return n, nil
+	}
+
+	return mw.write(p)
+}
+
+// write writes the line into RAM and to the underlying writer.
+func (mw *memoryWriter) write(p []byte) (int, error) {
 	// Add to RAM.
 	mw.pl.addToRAMLine(p)
 
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"time"
@@ -40,6 +41,20 @@ type ProgramLogger struct {
 	LogBufferFull bool
 	Program       string
 	Console       io.Writer
+
+	// Child loggers.
+	parent *ProgramLogger // Owner of the RAM buffer for child loggers.
+	out    io.Writer      // JSON line destination (file + RAM).
+
+	// Crash reporting.
+	logDir     string
+	crashLines int
+	repanic    bool
+
+	// Panic hooks, registered on the root logger.
+	hooksMu    sync.Mutex
+	panicHooks map[int]func(r any, fatal bool)
+	nextHook   int
 }
 
 // Log entry constants.
@@ -111,6 +126,11 @@ type LoggingConfig struct {
 	MaxBackups  int       // Number of old log files to keep.
 	Console     io.Writer // Where to write console output (os.Stdout or os.Stderr).
 	Program     string    // Tubarr or Metarr.
+
+	CrashReportLines int  // Number of buffered log lines written into crash reports.
+	RepanicOnCrash   bool // Re-panic after a recovered panic is logged.
+
+	Audit bool // Chain each JSON line to the previous one with a hash field (see VerifyAuditLog).
 }
 
 // init runs before other functions.
@@ -134,6 +154,9 @@ func SetupLogging(cfg LoggingConfig) (*ProgramLogger, error) {
 	if cfg.MaxBackups == 0 {
 		cfg.MaxBackups = 5
 	}
+	if cfg.CrashReportLines == 0 {
+		cfg.CrashReportLines = defaultCrashReportLines
+	}
 
 	// Set up zerolog
 	fileWriter := &lumberjack.Logger{
@@ -145,20 +168,18 @@ func SetupLogging(cfg LoggingConfig) (*ProgramLogger, error) {
 
 	Loggable = true
 
-	// Program logger model
-	pl := &ProgramLogger{
-		LogBuffer: make([][]byte, logBufferSize),
-		Program:   cfg.Program,
-		Console:   cfg.Console,
-	}
-
-	// Write to file + RAM
-	mw := &memoryWriter{
-		pl:     pl,
-		writer: fileWriter,
+	// Program logger model writing to file + RAM.
+	pl := NewProgramLogger(cfg.Program, cfg.Console, fileWriter)
+	if cfg.Audit {
+		prev, err := lastAuditHash(cfg.LogFilePath)
+		if err != nil {
+			return nil, fmt.Errorf("could not resume audit chain: %w", err)
+		}
+		pl.out.(*memoryWriter).chain = &auditChain{prev: prev}
 	}
-
-	pl.FileLogger = zerolog.New(mw).With().Timestamp().Logger()
+	pl.logDir = filepath.Dir(cfg.LogFilePath)
+	pl.crashLines = cfg.CrashReportLines
+	pl.repanic = cfg.RepanicOnCrash
 
 	// Only load in file from Tubarr on start, Metarr load in should
 	// be handled by the caller (usually in server handlers).
@@ -175,6 +196,27 @@ func SetupLogging(cfg LoggingConfig) (*ProgramLogger, error) {
 	return pl, nil
 }
 
+// NewProgramLogger builds a program logger which writes JSON log lines into RAM and to the given writer.
+//
+// Unlike SetupLogging, it does not touch global logging state or register the logger in LogAccessMap.
+func NewProgramLogger(program string, console, out io.Writer) *ProgramLogger {
+	pl := &ProgramLogger{
+		LogBuffer:  make([][]byte, logBufferSize),
+		Program:    program,
+		Console:    console,
+		crashLines: defaultCrashReportLines,
+	}
+
+	// Write to output + RAM.
+	pl.out = &memoryWriter{
+		pl:     pl,
+		writer: out,
+	}
+
+	pl.FileLogger = zerolog.New(pl.out).With().Timestamp().Logger()
+	return pl
+}
+
 // GetRecentLogsForProgram returns logs from RAM for a specific program.
 // Usually used by server handlers to fill display views.
 func GetRecentLogsForProgram(program string) [][]byte {
@@ -241,6 +283,10 @@ func buildLogMessage(prefix, msg string, caller *callerInfo) string {
 
 // GetRecentLogs returns logs from RAM for this program logger.
 func (pl *ProgramLogger) GetRecentLogs() [][]byte {
+	if pl.parent != nil {
+		return pl.parent.GetRecentLogs()
+	}
+
 	pl.LogBufferLock.RLock()
 	defer pl.LogBufferLock.RUnlock()
 
@@ -263,6 +309,10 @@ func (pl *ProgramLogger) GetRecentLogs() [][]byte {
 
 // GetLogsSincePosition returns only the logs added since a specific buffer position.
 func (pl *ProgramLogger) GetLogsSincePosition(lastPos int, wasWrapped bool) [][]byte {
+	if pl.parent != nil {
+		return pl.parent.GetLogsSincePosition(lastPos, wasWrapped)
+	}
+
 	pl.LogBufferLock.RLock()
 	defer pl.LogBufferLock.RUnlock()
 
@@ -311,6 +361,10 @@ func (pl *ProgramLogger) GetLogsSincePosition(lastPos int, wasWrapped bool) [][]
 
 // GetBufferPosition returns the current write position in the log buffer.
 func (pl *ProgramLogger) GetBufferPosition() int {
+	if pl.parent != nil {
+		return pl.parent.GetBufferPosition()
+	}
+
 	pl.LogBufferLock.RLock()
 	defer pl.LogBufferLock.RUnlock()
 	return pl.LogBufferPos
@@ -318,6 +372,10 @@ func (pl *ProgramLogger) GetBufferPosition() int {
 
 // IsBufferFull returns whether the log buffer is full.
 func (pl *ProgramLogger) IsBufferFull() bool {
+	if pl.parent != nil {
+		return pl.parent.IsBufferFull()
+	}
+
 	pl.LogBufferLock.RLock()
 	defer pl.LogBufferLock.RUnlock()
 	return pl.LogBufferFull
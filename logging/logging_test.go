@@ -0,0 +1,228 @@
+package logging_test
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/TubarrApp/gocommon/logging"
+	"github.com/TubarrApp/gocommon/logging/loggingtest"
+)
+
+// Recover -----------------------------------------------------------------------------------
+
+func TestRecoverLogsPanic(t *testing.T) {
+	tl := loggingtest.NewTestLogger(t)
+
+	func() {
+		defer tl.Recover()
+		panic("boom")
+	}()
+
+	tl.AssertLogged(t, loggingtest.LevelError, "boom")
+	errs := tl.EntriesAt(loggingtest.LevelError)
+	if stack, _ := errs[0].Fields["stack"].(string); !strings.Contains(stack, "goroutine") {
+		t.Errorf("expected stack field, got %q", stack)
+	}
+
+	// Panics in goroutines started through Go are recovered too.
+	tl.Go(func() {
+		panic("goroutine boom")
+	})
+	deadline := time.Now().Add(5 * time.Second)
+	for len(tl.EntriesAt(loggingtest.LevelError)) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	tl.AssertLogged(t, loggingtest.LevelError, "goroutine boom")
+}
+
+func TestRecoverWritesCrashReport(t *testing.T) {
+	dir := t.TempDir()
+	pl, err := logging.SetupLogging(logging.LoggingConfig{
+		LogFilePath: filepath.Join(dir, "test.log"),
+		Console:     &bytes.Buffer{},
+		Program:     "RecoverTest",
+	})
+	if err != nil {
+		t.Fatalf("setup logging: %v", err)
+	}
+
+	pl.I("before the crash")
+
+	// Panics in quick succession each get their own report.
+	for range 2 {
+		func() {
+			defer pl.Recover()
+			panic("crash report")
+		}()
+	}
+
+	reports, _ := filepath.Glob(filepath.Join(dir, "crash_recovertest_*.log"))
+	if len(reports) != 2 {
+		t.Fatalf("expected two crash reports, got %v", reports)
+	}
+	for _, report := range reports {
+		content, err := os.ReadFile(report)
+		if err != nil {
+			t.Fatalf("read crash report: %v", err)
+		}
+		for _, want := range []string{"Panic: crash report", "before the crash", "Stack:"} {
+			if !bytes.Contains(content, []byte(want)) {
+				t.Errorf("crash report %q missing %q", report, want)
+			}
+		}
+	}
+}
+
+func TestOnPanicHooks(t *testing.T) {
+	tl := loggingtest.NewTestLogger(t)
+
+	var got []string
+	remove := tl.OnPanic(func(r any, fatal bool) {
+		if fatal {
+			t.Errorf("expected non-fatal panic")
+		}
+		got = append(got, fmt.Sprint(r))
+	})
+	tl.OnPanic(func(any, bool) {
+		panic("bad hook")
+	})
+	tl.OnPanic(func(r any, _ bool) {
+		got = append(got, "last")
+	})
+
+	func() {
+		defer tl.Recover()
+		panic("first")
+	}()
+	if !slices.Equal(got, []string{"first", "last"}) {
+		t.Errorf("unexpected hook calls: %v", got)
+	}
+
+	// Removed hooks do not run, hooks run for panics recovered by child loggers.
+	remove()
+	child, closeFn, err := tl.TeeToFile(filepath.Join(t.TempDir(), "job.log"))
+	if err != nil {
+		t.Fatalf("tee to file: %v", err)
+	}
+	defer closeFn()
+
+	got = nil
+	func() {
+		defer child.Recover()
+		panic("second")
+	}()
+	if !slices.Equal(got, []string{"last"}) {
+		t.Errorf("unexpected hook calls after remove: %v", got)
+	}
+}
+
+// TeeToFile ---------------------------------------------------------------------------------
+
+func TestTeeToFile(t *testing.T) {
+	tl := loggingtest.NewTestLogger(t)
+	jobLog := filepath.Join(t.TempDir(), "jobs", "job1.log")
+
+	child, closeFn, err := tl.TeeToFile(jobLog)
+	if err != nil {
+		t.Fatalf("tee to file: %v", err)
+	}
+
+	child.I("job line \x1b[92mcolored\x1b[0m")
+	tl.I("main only line")
+	if err := closeFn(); err != nil {
+		t.Fatalf("close job log: %v", err)
+	}
+	child.I("after close")
+
+	content, err := os.ReadFile(jobLog)
+	if err != nil {
+		t.Fatalf("read job log: %v", err)
+	}
+	if !bytes.Contains(content, []byte("job line colored")) {
+		t.Errorf("job log missing job line: %s", content)
+	}
+	if bytes.Contains(content, []byte("main only")) || bytes.Contains(content, []byte("after close")) {
+		t.Errorf("job log contains lines from outside the job: %s", content)
+	}
+
+	// Main log receives everything, child shares the parent's buffer.
+	tl.AssertLogged(t, loggingtest.LevelInfo, "job line")
+	tl.AssertLogged(t, loggingtest.LevelInfo, "after close")
+	if got, want := len(child.GetRecentLogs()), len(tl.GetRecentLogs()); got != want {
+		t.Errorf("expected child to share buffer (%d lines), got %d", want, got)
+	}
+}
+
+// Audit -------------------------------------------------------------------------------------
+
+func TestAuditLogChain(t *testing.T) {
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "audit.log")
+
+	setup := func() *logging.ProgramLogger {
+		pl, err := logging.SetupLogging(logging.LoggingConfig{
+			LogFilePath: logPath,
+			Console:     &bytes.Buffer{},
+			Program:     "AuditTest",
+			Audit:       true,
+		})
+		if err != nil {
+			t.Fatalf("setup logging: %v", err)
+		}
+		return pl
+	}
+
+	// Chain continues across restarts.
+	pl := setup()
+	pl.I("edited title of %q", "video.mp4")
+	pl.W("edited date")
+	pl = setup()
+	pl.I("edited description")
+
+	report, err := logging.VerifyAuditLog(logPath)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if !report.OK() || report.Verified != report.Lines || report.Anchor != logging.AuditAnchorGenesis {
+		t.Fatalf("expected intact chain, got %+v", report)
+	}
+
+	content, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("read log: %v", err)
+	}
+
+	// Without the first line, the anchor cannot be verified.
+	cutPath := filepath.Join(dir, "cut.log")
+	_, rest, _ := bytes.Cut(content, []byte("\n"))
+	if err := os.WriteFile(cutPath, rest, 0o644); err != nil {
+		t.Fatalf("write log: %v", err)
+	}
+	report, err = logging.VerifyAuditLog(cutPath)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if !report.OK() || report.Anchor != logging.AuditAnchorUnverified || report.Verified != report.Lines-1 {
+		t.Fatalf("expected unverified anchor, got %+v", report)
+	}
+
+	// Tamper with the second line.
+	tampered := bytes.Replace(content, []byte("video.mp4"), []byte("other.mp4"), 1)
+	if err := os.WriteFile(logPath, tampered, 0o644); err != nil {
+		t.Fatalf("write log: %v", err)
+	}
+
+	report, err = logging.VerifyAuditLog(logPath)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if len(report.Breaks) != 1 || report.Breaks[0].Line != 2 {
+		t.Fatalf("expected one break at line 2, got %+v", report.Breaks)
+	}
+}
@@ -0,0 +1,202 @@
+// Package loggingtest provides an in-memory ProgramLogger and assertion helpers for tests.
+package loggingtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/TubarrApp/gocommon/logging"
+	"github.com/TubarrApp/gocommon/sharedregex"
+)
+
+// Log levels as written into the JSON log lines.
+const (
+	LevelDebug   = "debug"
+	LevelError   = "error"
+	LevelInfo    = "info"
+	LevelSuccess = "success"
+	LevelWarn    = "warn"
+	LevelPlain   = "" // P() lines carry no level.
+)
+
+// Entry is a single parsed JSON log line.
+type Entry struct {
+	Level   string
+	Message string
+	Fields  map[string]any // All decoded JSON fields, including level and message.
+	Raw     []byte
+}
+
+// TestLogger is a ProgramLogger backed by an in-memory sink.
+type TestLogger struct {
+	*logging.ProgramLogger
+	sink *sink
+}
+
+// NewTestLogger returns a logger writing JSON lines to memory and console output to t.Log.
+//
+// The logger is not registered in logging.LogAccessMap and does not alter global logging state.
+func NewTestLogger(t testing.TB) *TestLogger {
+	t.Helper()
+
+	s := &sink{}
+	console := &tWriter{t: t}
+	t.Cleanup(console.close)
+
+	return &TestLogger{
+		ProgramLogger: logging.NewProgramLogger(t.Name(), console, s),
+		sink:          s,
+	}
+}
+
+// Entries returns every line written so far, in write order.
+func (tl *TestLogger) Entries() []Entry {
+	return tl.sink.entries()
+}
+
+// EntriesAt returns the lines written so far at the given level.
+func (tl *TestLogger) EntriesAt(level string) []Entry {
+	var out []Entry
+	for _, e := range tl.sink.entries() {
+		if e.Level == level {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// Reset discards all recorded lines.
+func (tl *TestLogger) Reset() {
+	tl.sink.reset()
+}
+
+// AssertLogged fails the test if no line at the level contains the substring.
+func (tl *TestLogger) AssertLogged(t testing.TB, level, substring string) {
+	t.Helper()
+	if tl.find(level, substring) {
+		return
+	}
+	t.Errorf("expected %s log containing %q, got:\n%s", levelName(level), substring, tl.dump())
+}
+
+// AssertNotLogged fails the test if any line at the level contains the substring.
+func (tl *TestLogger) AssertNotLogged(t testing.TB, level, substring string) {
+	t.Helper()
+	if !tl.find(level, substring) {
+		return
+	}
+	t.Errorf("unexpected %s log containing %q, got:\n%s", levelName(level), substring, tl.dump())
+}
+
+// AssertCount fails the test if the number of lines at the level differs from want.
+func (tl *TestLogger) AssertCount(t testing.TB, level string, want int) {
+	t.Helper()
+	if got := len(tl.EntriesAt(level)); got != want {
+		t.Errorf("expected %d %s log lines, got %d:\n%s", want, levelName(level), got, tl.dump())
+	}
+}
+
+// **** Private **********************************************************************************
+
+// find reports whether a line at the level contains the substring.
+func (tl *TestLogger) find(level, substring string) bool {
+	for _, e := range tl.sink.entries() {
+		if e.Level == level && strings.Contains(e.Message, substring) {
+			return true
+		}
+	}
+	return false
+}
+
+// dump renders recorded lines for failure messages.
+func (tl *TestLogger) dump() string {
+	entries := tl.sink.entries()
+	if len(entries) == 0 {
+		return "\t(no log lines)"
+	}
+
+	var b strings.Builder
+	for _, e := range entries {
+		b.WriteByte('\t')
+		b.Write(bytes.TrimRight(e.Raw, "\n"))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// levelName returns a printable name for a level.
+func levelName(level string) string {
+	if level == LevelPlain {
+		return "plain"
+	}
+	return level
+}
+
+// sink stores JSON log lines in memory.
+type sink struct {
+	mu    sync.Mutex
+	lines []Entry
+}
+
+// Write implements io.Writer for the ProgramLogger's JSON output.
+func (s *sink) Write(p []byte) (int, error) {
+	e := Entry{
+		Raw: append([]byte(nil), p...),
+	}
+	if err := json.Unmarshal(p, &e.Fields); err == nil {
+		e.Level, _ = e.Fields["level"].(string)
+		e.Message, _ = e.Fields["message"].(string)
+	}
+
+	s.mu.Lock()
+	s.lines = append(s.lines, e)
+	s.mu.Unlock()
+
+	return len(p), nil
+}
+
+// entries returns a copy of the stored lines.
+func (s *sink) entries() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Entry(nil), s.lines...)
+}
+
+// reset discards the stored lines.
+func (s *sink) reset() {
+	s.mu.Lock()
+	s.lines = nil
+	s.mu.Unlock()
+}
+
+// tWriter routes console output to t.Log until the test finishes.
+type tWriter struct {
+	mu     sync.Mutex
+	t      testing.TB
+	closed bool
+}
+
+// ansiStripper removes terminal colors from console output.
+var ansiStripper = sharedregex.AnsiEscapeCompile()
+
+// Write implements io.Writer for console output.
+func (w *tWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	// t.Log panics once the test has completed.
+	if !w.closed {
+		w.t.Log(strings.TrimRight(ansiStripper.ReplaceAllString(string(p), ""), "\n"))
+	}
+	return len(p), nil
+}
+
+// close stops forwarding output to the test.
+func (w *tWriter) close() {
+	w.mu.Lock()
+	w.closed = true
+	w.mu.Unlock()
+}
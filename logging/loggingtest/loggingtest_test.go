@@ -0,0 +1,42 @@
+package loggingtest
+
+import (
+	"testing"
+
+	"github.com/TubarrApp/gocommon/logging"
+)
+
+func TestTestLogger(t *testing.T) {
+	tl := NewTestLogger(t)
+
+	tl.I("Downloading %q", "video.mp4")
+	tl.E("Transcode failed: %v", "exit status 1")
+	tl.P("plain line")
+
+	tl.AssertLogged(t, LevelInfo, "video.mp4")
+	tl.AssertLogged(t, LevelError, "exit status 1")
+	tl.AssertLogged(t, LevelPlain, "plain line")
+	tl.AssertNotLogged(t, LevelWarn, "video.mp4")
+	tl.AssertCount(t, LevelError, 1)
+
+	// Error lines carry caller information.
+	errs := tl.EntriesAt(LevelError)
+	if fn, _ := errs[0].Fields["function"].(string); fn == "" {
+		t.Errorf("expected caller function field, got %v", errs[0].Fields)
+	}
+
+	// Lines are also kept in the RAM buffer.
+	if got := len(tl.GetRecentLogs()); got != len(tl.Entries()) {
+		t.Errorf("expected %d buffered lines, got %d", len(tl.Entries()), got)
+	}
+
+	// Not registered globally.
+	if logs := logging.GetRecentLogsForProgram(t.Name()); logs != nil {
+		t.Errorf("test logger should not be registered in LogAccessMap")
+	}
+
+	tl.Reset()
+	if len(tl.Entries()) != 0 {
+		t.Errorf("expected no entries after reset")
+	}
+}
@@ -0,0 +1,188 @@
+package logging
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/TubarrApp/gocommon/sharedconsts"
+)
+
+// Crash report constants.
+const (
+	defaultCrashReportLines = 200
+	crashTimeFormat         = "2006-01-02_15-04-05.000000"
+
+	jPanic = "panic"
+	jStack = "stack"
+)
+
+// Recover logs a panic in the calling goroutine, writes a crash report and optionally re-panics.
+//
+// Must be deferred directly, e.g. "defer pl.Recover()", or recover() will not see the panic.
+func (pl *ProgramLogger) Recover() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	pl.handlePanic(r, debug.Stack())
+}
+
+// Go runs fn in a new goroutine which recovers and logs any panic.
+func (pl *ProgramLogger) Go(fn func()) {
+	go func() {
+		defer pl.Recover()
+		fn()
+	}()
+}
+
+// OnPanic registers fn to run when Recover handles a panic, after the crash report is written.
+//
+// Fatal is true if the panic will be re-raised. Hooks registered through child loggers run for
+// panics recovered by any logger sharing the root. Call remove to unregister the hook.
+func (pl *ProgramLogger) OnPanic(fn func(r any, fatal bool)) (remove func()) {
+	root := pl.root()
+
+	root.hooksMu.Lock()
+	defer root.hooksMu.Unlock()
+
+	if root.panicHooks == nil {
+		root.panicHooks = make(map[int]func(any, bool))
+	}
+	id := root.nextHook
+	root.nextHook++
+	root.panicHooks[id] = fn
+
+	return func() {
+		root.hooksMu.Lock()
+		delete(root.panicHooks, id)
+		root.hooksMu.Unlock()
+	}
+}
+
+// handlePanic logs the panic with its stack and writes the crash report.
+func (pl *ProgramLogger) handlePanic(r any, stack []byte) {
+	msg := fmt.Sprintf("Recovered panic: %v", r)
+
+	// Write to console.
+	pl.writeToConsole(buildLogMessage(sharedconsts.LogTagError, msg+"\n"+string(stack), nil))
+
+	// Write to file + RAM.
+	pl.FileLogger.Error().
+		Str(jPanic, fmt.Sprint(r)).
+		Str(jStack, string(stack)).
+		Msg(ansiStripper.ReplaceAllString(msg, ""))
+
+	// Write crash report.
+	if path, err := pl.writeCrashReport(r, stack); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write crash report: %v\n", err)
+	} else if path != "" {
+		pl.writeToConsole(buildLogMessage(sharedconsts.LogTagError, fmt.Sprintf("Crash report written to %q", path), nil))
+	}
+
+	pl.runPanicHooks(r, pl.repanic)
+
+	if pl.repanic {
+		panic(r)
+	}
+}
+
+// runPanicHooks runs registered panic hooks in registration order, a panicking hook does not stop the others.
+func (pl *ProgramLogger) runPanicHooks(r any, fatal bool) {
+	root := pl.root()
+
+	root.hooksMu.Lock()
+	ids := slices.Sorted(maps.Keys(root.panicHooks))
+	hooks := make([]func(any, bool), 0, len(ids))
+	for _, id := range ids {
+		hooks = append(hooks, root.panicHooks[id])
+	}
+	root.hooksMu.Unlock()
+
+	for _, hook := range hooks {
+		func() {
+			defer func() {
+				if hr := recover(); hr != nil {
+					fmt.Fprintf(os.Stderr, "Panic hook failed: %v\n", hr)
+				}
+			}()
+			hook(r, fatal)
+		}()
+	}
+}
+
+// root returns the logger owning shared state.
+func (pl *ProgramLogger) root() *ProgramLogger {
+	if pl.parent != nil {
+		return pl.parent
+	}
+	return pl
+}
+
+// writeCrashReport writes the panic, stack and last buffered log lines into the log directory.
+//
+// Returns an empty path if the logger has no log directory.
+func (pl *ProgramLogger) writeCrashReport(r any, stack []byte) (path string, err error) {
+	if pl.logDir == "" {
+		return "", nil
+	}
+
+	now := time.Now()
+
+	// Keep last N buffered lines.
+	lines := pl.GetRecentLogs()
+	if len(lines) > pl.crashLines {
+		lines = lines[len(lines)-pl.crashLines:]
+	}
+
+	b := getLogBuilder()
+	defer b.Release()
+
+	fmt.Fprintf(b, "Program: %s\nTime: %s\nPanic: %v\n\nStack:\n%s\n", pl.Program, now.Format(time.RFC1123Z), r, stack)
+	fmt.Fprintf(b, "Last %d log lines:\n", len(lines))
+	for _, line := range lines {
+		b.Write(line)
+		if len(line) > 0 && line[len(line)-1] != '\n' {
+			b.WriteByte('\n')
+		}
+	}
+
+	f, err := createCrashReport(pl.logDir, pl.Program, now)
+	if err != nil {
+		return "", err
+	}
+	path = f.Name()
+
+	_, err = f.WriteString(b.String())
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not write crash report %q: %w", path, err)
+	}
+	return path, nil
+}
+
+// createCrashReport creates a new crash report file, named with the time and process ID.
+//
+// Existing reports are never overwritten, a panic in the same microsecond gets a numbered suffix.
+func createCrashReport(dir, program string, t time.Time) (*os.File, error) {
+	name := fmt.Sprintf("crash_%s_%s_%d", strings.ToLower(program), t.Format(crashTimeFormat), os.Getpid())
+	path := filepath.Join(dir, name+".log")
+	for i := 2; ; i++ {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, sharedconsts.PermsLogFile)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("could not create crash report %q: %w", path, err)
+		}
+		path = filepath.Join(dir, fmt.Sprintf("%s_%d.log", name, i))
+	}
+}
@@ -0,0 +1,85 @@
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/TubarrApp/gocommon/sharedconsts"
+
+	"github.com/rs/zerolog"
+)
+
+// TeeToFile returns a child logger which logs as normal and also writes its lines to the file at path.
+//
+// Useful for collecting every line for a single job (e.g. one download or transcode) in its own file.
+// Lines logged through the parent or other children are not written to the file. The child shares
+// the parent's RAM buffer. Call closeFn when the job finishes, later lines then only reach the main log.
+func (pl *ProgramLogger) TeeToFile(path string) (child *ProgramLogger, closeFn func() error, err error) {
+	// Create parent directories.
+	if err := os.MkdirAll(filepath.Dir(path), sharedconsts.PermsGenericDir); err != nil {
+		return nil, nil, fmt.Errorf("could not create directory for job log %q: %w", path, err)
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, sharedconsts.PermsLogFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not open job log %q: %w", path, err)
+	}
+	jw := &jobWriter{file: f}
+
+	child = &ProgramLogger{
+		Program:    pl.Program,
+		Console:    pl.Console,
+		parent:     pl.root(),
+		out:        io.MultiWriter(pl.out, jw),
+		logDir:     pl.logDir,
+		crashLines: pl.crashLines,
+		repanic:    pl.repanic,
+	}
+	child.FileLogger = zerolog.New(child.out).With().Timestamp().Logger()
+
+	return child, jw.Close, nil
+}
+
+// jobWriter writes JSON log lines to a job log file until closed.
+type jobWriter struct {
+	mu     sync.Mutex
+	file   *os.File
+	closed bool
+}
+
+// Write writes the ANSI-stripped, newline-terminated line to the job file.
+func (jw *jobWriter) Write(p []byte) (int, error) {
+	jw.mu.Lock()
+	defer jw.mu.Unlock()
+
+	// Drop lines after the job finished.
+	if jw.closed {
+		return len(p), nil
+	}
+
+	// Remove ANSI and terminate entries with newlines.
+	out := ansiStripper.ReplaceAll(p, nil)
+	if len(out) > 0 && out[len(out)-1] != '\n' {
+		out = append(out[:len(out):len(out)], '\n') // Never grow into the caller's buffer.
+	}
+
+	if _, err := jw.file.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// Close closes the job file. Safe to call more than once.
+func (jw *jobWriter) Close() error {
+	jw.mu.Lock()
+	defer jw.mu.Unlock()
+
+	if jw.closed {
+		return nil
+	}
+	jw.closed = true
+	return jw.file.Close()
+}
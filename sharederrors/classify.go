@@ -0,0 +1,78 @@
+package sharederrors
+
+import (
+	"context"
+	"errors"
+	"os"
+)
+
+// kinded is implemented by classified errors.
+type kinded interface {
+	Kind() Kind
+}
+
+// KindOf returns the classification of the first classified error in err's tree.
+//
+// Falls back to standard library errors (os.ErrNotExist, os.ErrPermission, timeouts)
+// when no error in the tree carries a Kind.
+func KindOf(err error) Kind {
+	if err == nil {
+		return KindUnknown
+	}
+
+	// Classified error in chain.
+	var k kinded
+	if errors.As(err, &k) {
+		return k.Kind()
+	}
+
+	// Standard library errors.
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return KindNotFound
+	case errors.Is(err, os.ErrPermission):
+		return KindPermission
+	case errors.Is(err, context.DeadlineExceeded),
+		errors.Is(err, os.ErrDeadlineExceeded),
+		isTemporary(err):
+		return KindTransient
+	}
+
+	return KindUnknown
+}
+
+// IsRetryable reports whether the operation may succeed if retried.
+func IsRetryable(err error) bool {
+	return KindOf(err) == KindTransient
+}
+
+// IsUserError reports whether the error was caused by user input (bad values or missing paths).
+func IsUserError(err error) bool {
+	switch KindOf(err) {
+	case KindInvalidInput, KindNotFound:
+		return true
+	default:
+		return false
+	}
+}
+
+// IsSystemError reports whether the error was caused by the environment rather than user input.
+func IsSystemError(err error) bool {
+	switch KindOf(err) {
+	case KindPermission, KindSystem, KindTransient:
+		return true
+	default:
+		return false
+	}
+}
+
+// isTemporary checks for timeout or temporary errors (e.g. net.Error, syscall.Errno).
+func isTemporary(err error) bool {
+	var t interface{ Timeout() bool }
+	if errors.As(err, &t) && t.Timeout() {
+		return true
+	}
+
+	var tmp interface{ Temporary() bool }
+	return errors.As(err, &tmp) && tmp.Temporary()
+}
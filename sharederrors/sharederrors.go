@@ -0,0 +1,90 @@
+// Package sharederrors provides sentinel and typed errors shared across Tubarr and Metarr.
+//
+// Errors carry a Kind which callers use to decide whether to retry, report to the user, or abort.
+package sharederrors
+
+// Kind classifies an error for handling decisions.
+type Kind int
+
+const (
+	KindUnknown      Kind = iota
+	KindInvalidInput      // The caller supplied a bad value.
+	KindNotFound          // A path or resource does not exist.
+	KindPermission        // Access was denied.
+	KindSystem            // The environment failed (e.g. disk, device, OS call).
+	KindTransient         // The operation may succeed if retried.
+)
+
+// String returns the name of the kind.
+func (k Kind) String() string {
+	switch k {
+	case KindInvalidInput:
+		return "invalid input"
+	case KindNotFound:
+		return "not found"
+	case KindPermission:
+		return "permission"
+	case KindSystem:
+		return "system"
+	case KindTransient:
+		return "transient"
+	default:
+		return "unknown"
+	}
+}
+
+// kindError is a sentinel error carrying a classification.
+type kindError struct {
+	msg  string
+	kind Kind
+}
+
+// Error returns the sentinel message.
+func (e *kindError) Error() string {
+	return e.msg
+}
+
+// Kind returns the classification of the sentinel.
+func (e *kindError) Kind() Kind {
+	return e.kind
+}
+
+// New returns a new classified sentinel error.
+//
+// Each call returns a distinct error, compare with errors.Is.
+func New(msg string, kind Kind) error {
+	return &kindError{msg: msg, kind: kind}
+}
+
+// Generic sentinels.
+var (
+	ErrInvalidInput = New("invalid input", KindInvalidInput)
+	ErrInvalidValue = New("invalid value", KindInvalidInput)
+	ErrInvalidSize  = New("invalid size", KindInvalidInput)
+	ErrNotFound     = New("not found", KindNotFound)
+	ErrPermission   = New("permission denied", KindPermission)
+	ErrSystem       = New("system failure", KindSystem)
+	ErrTransient    = New("temporary failure", KindTransient)
+)
+
+// Media validation sentinels.
+var (
+	ErrInvalidCodec           = New("invalid codec", KindInvalidInput)
+	ErrInvalidAccelType       = New("invalid GPU acceleration type", KindInvalidInput)
+	ErrCodecRequired          = New("codec required", KindInvalidInput)
+	ErrDeviceNodeRequired     = New("device node required", KindInvalidInput)
+	ErrDeviceNodeNotFound     = New("device node not found", KindNotFound)
+	ErrInvalidQuality         = New("invalid transcode quality", KindInvalidInput)
+	ErrInvalidPreset          = New("invalid transcode preset", KindInvalidInput)
+	ErrInvalidMemorySize      = New("invalid memory size", KindInvalidInput)
+	ErrUnsupportedExtension   = New("unsupported extension", KindInvalidInput)
+	ErrUnsupportedTemplateTag = New("unsupported template tag", KindInvalidInput)
+)
+
+// Filesystem sentinels.
+var (
+	ErrNotADirectory = New("not a directory", KindInvalidInput)
+	ErrNotAFile      = New("not a file", KindInvalidInput)
+	ErrPathNotFound  = New("path does not exist", KindNotFound)
+	ErrCreateFailed  = New("failed to create", KindSystem)
+)
@@ -0,0 +1,65 @@
+package sharederrors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestKindOf(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		kind Kind
+	}{
+		{"nil", nil, KindUnknown},
+		{"plain", errors.New("plain"), KindUnknown},
+		{"sentinel", ErrInvalidCodec, KindInvalidInput},
+		{"wrapped sentinel", fmt.Errorf("context: %w", ErrPermission), KindPermission},
+		{"validation error", &ValidationError{Field: "codec", Value: "x", Err: ErrInvalidCodec}, KindInvalidInput},
+		{"path error sentinel first", &PathError{Op: "create", Path: "/x", Err: ErrCreateFailed, Cause: os.ErrPermission}, KindSystem},
+		{"path error cause only", &PathError{Op: "stat", Path: "/x", Cause: os.ErrNotExist}, KindNotFound},
+		{"os not exist", fmt.Errorf("open: %w", os.ErrNotExist), KindNotFound},
+		{"os permission", os.ErrPermission, KindPermission},
+		{"deadline", context.DeadlineExceeded, KindTransient},
+	}
+
+	for _, tt := range tests {
+		if got := KindOf(tt.err); got != tt.kind {
+			t.Errorf("%s: expected kind %v, got %v", tt.name, tt.kind, got)
+		}
+	}
+}
+
+func TestClassification(t *testing.T) {
+	if !IsUserError(ErrNotADirectory) || IsSystemError(ErrNotADirectory) {
+		t.Errorf("expected ErrNotADirectory to be a user error only")
+	}
+	if !IsSystemError(ErrCreateFailed) || IsUserError(ErrCreateFailed) {
+		t.Errorf("expected ErrCreateFailed to be a system error only")
+	}
+	if !IsRetryable(ErrTransient) || IsRetryable(ErrInvalidValue) {
+		t.Errorf("unexpected retryable classification")
+	}
+}
+
+func TestErrorsIsAs(t *testing.T) {
+	err := fmt.Errorf("loading config: %w", &PathError{Op: "create directory", Path: "/x", Err: ErrCreateFailed, Cause: os.ErrPermission})
+
+	if !errors.Is(err, ErrCreateFailed) || !errors.Is(err, os.ErrPermission) {
+		t.Errorf("expected error to match both sentinel and cause")
+	}
+
+	var pe *PathError
+	if !errors.As(err, &pe) || pe.Path != "/x" {
+		t.Errorf("expected PathError for %q", "/x")
+	}
+
+	ve := &ValidationError{Field: "video codec", Value: "bogus", Supported: []string{"h264"}, Err: ErrInvalidCodec}
+	if msg := ve.Error(); !strings.Contains(msg, `"bogus" is not valid`) || !strings.Contains(msg, "h264") {
+		t.Errorf("unexpected message %q", msg)
+	}
+}
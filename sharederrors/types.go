@@ -0,0 +1,77 @@
+package sharederrors
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidationError records a rejected value and, where known, the accepted alternatives.
+//
+// Unwraps to its sentinel, e.g. errors.Is(err, ErrInvalidCodec).
+type ValidationError struct {
+	Field     string   // What was validated, e.g. "video codec".
+	Value     string   // The rejected input.
+	Reason    string   // Optional explanation, replaces the default "is not valid".
+	Supported []string // Optional list of accepted values.
+	Err       error    // Sentinel classifying the failure.
+}
+
+// Error returns the validation failure message.
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+
+	if e.Reason != "" {
+		fmt.Fprintf(&b, "%s %q: %s", e.Field, e.Value, e.Reason)
+	} else {
+		fmt.Fprintf(&b, "%s %q is not valid", e.Field, e.Value)
+	}
+
+	if len(e.Supported) > 0 {
+		fmt.Fprintf(&b, ". Supported: %v", e.Supported)
+	}
+	return b.String()
+}
+
+// Unwrap returns the sentinel.
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// PathError records a filesystem failure for a path.
+//
+// Unwraps to both its sentinel and the underlying cause, so errors.Is matches
+// e.g. ErrCreateFailed as well as os.ErrPermission.
+type PathError struct {
+	Op    string // What was attempted, e.g. "stat directory".
+	Path  string
+	Err   error // Sentinel classifying the failure (may be nil).
+	Cause error // Underlying error (may be nil).
+}
+
+// Error returns the path failure message.
+func (e *PathError) Error() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %q", e.Op, e.Path)
+
+	if e.Err != nil {
+		b.WriteString(": ")
+		b.WriteString(e.Err.Error())
+	}
+	if e.Cause != nil {
+		b.WriteString(": ")
+		b.WriteString(e.Cause.Error())
+	}
+	return b.String()
+}
+
+// Unwrap returns the sentinel and the cause.
+func (e *PathError) Unwrap() []error {
+	errs := make([]error, 0, 2)
+	if e.Err != nil {
+		errs = append(errs, e.Err)
+	}
+	if e.Cause != nil {
+		errs = append(errs, e.Cause)
+	}
+	return errs
+}
@@ -1,12 +1,12 @@
 package sharedvalidation
 
 import (
-	"fmt"
 	"os"
 	"runtime"
 	"strings"
 
 	"github.com/TubarrApp/gocommon/sharedconsts"
+	"github.com/TubarrApp/gocommon/sharederrors"
 )
 
 // ValidateVideoCodec validates a video codec string and returns the normalized codec name.
@@ -33,7 +33,12 @@ func ValidateVideoCodec(c string) (string, error) {
 		return c, nil
 	}
 
-	return "", fmt.Errorf("video codec %q is not valid. Supported: %v", c, sharedconsts.ValidVideoCodecs)
+	return "", &sharederrors.ValidationError{
+		Field:     "video codec",
+		Value:     c,
+		Supported: sortedKeys(sharedconsts.ValidVideoCodecs),
+		Err:       sharederrors.ErrInvalidCodec,
+	}
 }
 
 // ValidateVideoCodecWithAccel validates a video codec string with GPU acceleration context.
@@ -48,7 +53,12 @@ func ValidateVideoCodecWithAccel(c, accelType string) (validVideoCodec string, e
 	// Check if empty codec is allowed with the given acceleration type.
 	if c == "" &&
 		(accelType != "" && accelType != sharedconsts.AccelTypeAuto) {
-		return "", fmt.Errorf("GPU acceleration type %q requires a codec (entered %q)", accelType, c)
+		return "", &sharederrors.ValidationError{
+			Field:  "GPU acceleration type",
+			Value:  accelType,
+			Reason: "requires a video codec",
+			Err:    sharederrors.ErrCodecRequired,
+		}
 	}
 
 	return c, nil
@@ -78,7 +88,12 @@ func ValidateAudioCodec(a string) (validAudioCodec string, err error) {
 		return a, nil
 	}
 
-	return "", fmt.Errorf("audio codec %q is not valid. Supported: %v", a, sharedconsts.ValidAudioCodecs)
+	return "", &sharederrors.ValidationError{
+		Field:     "audio codec",
+		Value:     a,
+		Supported: sortedKeys(sharedconsts.ValidAudioCodecs),
+		Err:       sharederrors.ErrInvalidCodec,
+	}
 }
 
 // ValidateGPUAccelType validates a GPU acceleration type string.
@@ -97,7 +112,12 @@ func ValidateGPUAccelType(a string) (validAccelType string, err error) {
 	}
 
 	// Return error on map check failure.
-	return "", fmt.Errorf("%s GPU acceleration type %q is not valid. Supported: %v", sharedconsts.LogTagError, a, sharedconsts.ValidGPUAccelTypes)
+	return "", &sharederrors.ValidationError{
+		Field:     "GPU acceleration type",
+		Value:     a,
+		Supported: sortedKeys(sharedconsts.ValidGPUAccelTypes),
+		Err:       sharederrors.ErrInvalidAccelType,
+	}
 }
 
 // OSSupportsAccelType verified OS support for this acceleration type.
@@ -127,7 +147,12 @@ func ValidateAccelTypeDeviceNode(g, nodePath string) (validNodePath string, err
 	if nodePath == "" {
 		switch g {
 		case sharedconsts.AccelTypeVAAPI:
-			return "", fmt.Errorf("acceleration type %q requires a device directory on Linux systems", g)
+			return "", &sharederrors.ValidationError{
+				Field:  "GPU acceleration type",
+				Value:  g,
+				Reason: "requires a device directory on Linux systems",
+				Err:    sharederrors.ErrDeviceNodeRequired,
+			}
 		default: // Sent in empty.
 			return nodePath, nil
 		}
@@ -135,7 +160,12 @@ func ValidateAccelTypeDeviceNode(g, nodePath string) (validNodePath string, err
 
 	// Check device node.
 	if _, err := os.Stat(nodePath); os.IsNotExist(err) {
-		return "", fmt.Errorf("driver node path %q does not appear to exist?", nodePath)
+		return "", &sharederrors.PathError{
+			Op:    "stat driver node",
+			Path:  nodePath,
+			Err:   sharederrors.ErrDeviceNodeNotFound,
+			Cause: err,
+		}
 	}
 
 	return nodePath, nil
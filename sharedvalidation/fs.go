@@ -4,11 +4,14 @@ package sharedvalidation
 import (
 	"errors"
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/TubarrApp/gocommon/sharedconsts"
+	"github.com/TubarrApp/gocommon/sharederrors"
 )
 
 // ValidateDirectory validates that the directory exists, else creates it if desired.
@@ -24,30 +27,30 @@ func ValidateDirectory(dir string, createIfNotFound bool, templateMap map[string
 	info, err := os.Stat(dir)
 	if err == nil { // Err IS nil.
 		if !info.IsDir() {
-			return false, nil, fmt.Errorf("path %q is a file, not a directory", dir)
+			return false, nil, &sharederrors.PathError{Op: "validate directory", Path: dir, Err: sharederrors.ErrNotADirectory}
 		}
 		return false, info, nil
 	}
 
 	// Error other than non-existence.
 	if !errors.Is(err, os.ErrNotExist) {
-		return false, nil, fmt.Errorf("failed to stat directory %q: %w", dir, err)
+		return false, nil, &sharederrors.PathError{Op: "stat directory", Path: dir, Cause: err}
 	}
 
 	// Does not exist, should not create.
 	if !createIfNotFound {
-		return false, nil, fmt.Errorf("directory %q does not exist", dir)
+		return false, nil, &sharederrors.PathError{Op: "validate directory", Path: dir, Err: sharederrors.ErrPathNotFound, Cause: err}
 	}
 
 	// Generate new directories.
 	if err := os.MkdirAll(dir, sharedconsts.PermsGenericDir); err != nil {
-		return false, nil, fmt.Errorf("directory %q does not exist and failed to create: %w", dir, err)
+		return false, nil, &sharederrors.PathError{Op: "create directory", Path: dir, Err: sharederrors.ErrCreateFailed, Cause: err}
 	}
 
 	// Stat newly generated directory.
 	info, err = os.Stat(dir)
 	if err != nil {
-		return false, nil, fmt.Errorf("failed to stat %q", dir)
+		return false, nil, &sharederrors.PathError{Op: "stat directory", Path: dir, Cause: err}
 	}
 	return false, info, nil
 }
@@ -65,25 +68,25 @@ func ValidateFile(path string, createIfNotFound bool, templateMap map[string]str
 	info, err := os.Stat(path)
 	if err == nil { // Err IS nil.
 		if info.IsDir() {
-			return false, nil, fmt.Errorf("path %q is a directory, not a file", path)
+			return false, nil, &sharederrors.PathError{Op: "validate file", Path: path, Err: sharederrors.ErrNotAFile}
 		}
 		return false, info, nil
 	}
 
 	// Error other than non-existence.
 	if !errors.Is(err, os.ErrNotExist) {
-		return false, nil, fmt.Errorf("failed to stat file %q: %w", path, err)
+		return false, nil, &sharederrors.PathError{Op: "stat file", Path: path, Cause: err}
 	}
 
 	// Does not exist, should not create.
 	if !createIfNotFound {
-		return false, nil, fmt.Errorf("file %q does not exist", path)
+		return false, nil, &sharederrors.PathError{Op: "validate file", Path: path, Err: sharederrors.ErrPathNotFound, Cause: err}
 	}
 
 	// Generate new file (must close after os.Create()).
 	file, err := os.Create(path)
 	if err != nil {
-		return false, nil, fmt.Errorf("file %q does not exist and failed to create: %w", path, err)
+		return false, nil, &sharederrors.PathError{Op: "create file", Path: path, Err: sharederrors.ErrCreateFailed, Cause: err}
 	}
 	defer func() {
 		if closeErr := file.Close(); closeErr != nil {
@@ -93,7 +96,10 @@ func ValidateFile(path string, createIfNotFound bool, templateMap map[string]str
 
 	// Return info and nil/err.
 	fileInfo, err = os.Stat(path)
-	return false, fileInfo, err
+	if err != nil {
+		return false, nil, &sharederrors.PathError{Op: "stat file", Path: path, Cause: err}
+	}
+	return false, fileInfo, nil
 }
 
 // GetRenameFlag maps aliases from input if needed.
@@ -128,11 +134,13 @@ func checkTemplateTags(s string, templateMap map[string]struct{}) (hasTemplating
 		// Check all template tags for validity.
 		allValid := checkAllTemplateTags(s, templateMap)
 		if !allValid {
-			tags := make([]string, 0, len(templateMap))
-			for k := range templateMap {
-				tags = append(tags, k)
+			return true, &sharederrors.ValidationError{
+				Field:     "path",
+				Value:     s,
+				Reason:    "contains unsupported template tags",
+				Supported: sortedKeys(templateMap),
+				Err:       sharederrors.ErrUnsupportedTemplateTag,
 			}
-			return true, fmt.Errorf("directory contains unsupported template tags. Supported tags: %v", tags)
 		} else {
 			return true, nil
 		}
@@ -170,3 +178,8 @@ func checkAllTemplateTags(s string, templateMap map[string]struct{}) bool {
 		s = s[endAbs+2:]
 	}
 }
+
+// sortedKeys returns the keys of a set in sorted order, for error messages.
+func sortedKeys(m map[string]struct{}) []string {
+	return slices.Sorted(maps.Keys(m))
+}
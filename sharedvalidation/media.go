@@ -1,9 +1,10 @@
 package sharedvalidation
 
 import (
-	"fmt"
 	"strconv"
 	"strings"
+
+	"github.com/TubarrApp/gocommon/sharederrors"
 )
 
 // ValidateTranscodeQuality validates a transcode quality value (0-51 for x264/x265).
@@ -19,7 +20,12 @@ func ValidateTranscodeQuality(q string) (string, error) {
 	// Validate integer.
 	qNum, err := strconv.ParseInt(q, 10, 64)
 	if err != nil {
-		return "", fmt.Errorf("transcode quality should be numerical (0-51), got %q", q)
+		return "", &sharederrors.ValidationError{
+			Field:  "transcode quality",
+			Value:  q,
+			Reason: "should be numerical (0-51)",
+			Err:    sharederrors.ErrInvalidQuality,
+		}
 	}
 
 	// Clamp to valid range.
@@ -40,7 +46,12 @@ func ValidateTranscodePreset(q string) (string, error) {
 	// Validate integer.
 	qNum, err := strconv.ParseInt(q, 10, 64)
 	if err != nil {
-		return "", fmt.Errorf("transcode quality should be numerical (0-51), got %q", q)
+		return "", &sharederrors.ValidationError{
+			Field:  "transcode preset",
+			Value:  q,
+			Reason: "should be numerical (0-51)",
+			Err:    sharederrors.ErrInvalidPreset,
+		}
 	}
 
 	// Clamp to valid range.
@@ -1,11 +1,12 @@
 package sharedvalidation
 
 import (
-	"fmt"
+	"math"
 	"strconv"
 	"strings"
 
 	"github.com/TubarrApp/gocommon/sharedconsts"
+	"github.com/TubarrApp/gocommon/sharederrors"
 )
 
 // ValidateConcurrencyLimit validates a concurrency limit, returning at least 1.
@@ -20,40 +21,71 @@ func ValidateMinFreeMem(input string) (num string, err error) {
 		return "", nil
 	}
 
-	s := strings.ToUpper(strings.TrimSpace(input))
+	// Remove the unit (so KB/MB/GB all become K/M/G).
+	num, unit, _ := splitByteSize(strings.ToUpper(strings.TrimSpace(input)))
 
-	// Remove trailing B (so KB/MB/GB all become K/M/G).
-	s = strings.TrimSuffix(s, "B")
-
-	// After trimming B, valid suffixes are G, M, K, or no suffix.
-	hasUnit := false
-	switch {
-	case strings.HasSuffix(s, "G"),
-		strings.HasSuffix(s, "M"),
-		strings.HasSuffix(s, "K"):
-		hasUnit = true
-	}
-
-	if hasUnit {
+	switch unit {
+	case "G", "M", "K":
 		// Must be at least "0K".
-		if len(s) < 2 {
-			return "", fmt.Errorf("invalid format for min free mem: %q", input)
+		if num == "" {
+			return "", &sharederrors.ValidationError{
+				Field:  "minimum free memory",
+				Value:  input,
+				Reason: "invalid format",
+				Err:    sharederrors.ErrInvalidMemorySize,
+			}
 		}
+		if _, err := strconv.Atoi(num); err != nil {
+			return "", &sharederrors.ValidationError{
+				Field:  "minimum free memory",
+				Value:  input,
+				Reason: "invalid number",
+				Err:    sharederrors.ErrInvalidMemorySize,
+			}
+		}
+		return num + unit, nil
 
-		numPart := s[:len(s)-1]
-		if _, err := strconv.Atoi(numPart); err != nil {
-			return "", fmt.Errorf("invalid number %q in minimum free memory argument", input)
+	case "":
+		// No unit: must be a raw integer e.g. "2000".
+		if _, err := strconv.Atoi(num); err == nil {
+			return num, nil
 		}
+	}
 
-		return s, nil
+	return "", &sharederrors.ValidationError{
+		Field:  "minimum free memory",
+		Value:  input,
+		Reason: "must end with G, GB, M, MB, K, KB, or be an integer",
+		Err:    sharederrors.ErrInvalidMemorySize,
 	}
+}
 
-	// No unit: must be a raw integer e.g. "2000".
-	if _, err := strconv.Atoi(s); err != nil {
-		return "", fmt.Errorf("invalid min free memory argument %q, must end with G, GB, M, MB, K, KB, or be an integer", input)
+// ParseByteSize parses a size like "2G", "2GB", "2GiB", "1.5M" or "2000" (bytes) into bytes.
+// Units are binary multiples (1K = 1024), matching ValidateMinFreeMem. Fractions must come to
+// whole bytes.
+func ParseByteSize(input string) (uint64, error) {
+	num, _, mult := splitByteSize(strings.ToUpper(strings.TrimSpace(input)))
+
+	if n, err := strconv.ParseUint(num, 10, 64); err == nil {
+		if n > math.MaxUint64/mult {
+			return 0, byteSizeError(input, "is too large")
+		}
+		return n * mult, nil
 	}
 
-	return s, nil
+	// Fractions of a unit, e.g. "1.5M".
+	f, err := strconv.ParseFloat(num, 64)
+	if err != nil || f < 0 || math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0, byteSizeError(input, "must be a number of bytes, optionally followed by K, KB or KiB (or M, G, T), e.g. \"2GB\"")
+	}
+	bytes := f * float64(mult)
+	if bytes >= math.MaxUint64 {
+		return 0, byteSizeError(input, "is too large")
+	}
+	if bytes != math.Trunc(bytes) {
+		return 0, byteSizeError(input, "must be a whole number of bytes")
+	}
+	return uint64(bytes), nil
 }
 
 // ValidateMaxCPU validates a max CPU percentage (0.0 to 100.0).
@@ -90,5 +122,46 @@ func ValidateFFmpegOutputExt(o string) (string, error) {
 		return o, nil
 	}
 
-	return "", fmt.Errorf("output filetype %q is not supported", o)
+	return "", &sharederrors.ValidationError{
+		Field:     "output filetype",
+		Value:     o,
+		Supported: sortedKeys(sharedconsts.AllVidExtensions),
+		Err:       sharederrors.ErrUnsupportedExtension,
+	}
+}
+
+// **** Private **********************************************************************************
+
+// byteUnits are the accepted size suffixes, longest first, with their binary multipliers.
+var byteUnits = []struct {
+	suffix string
+	mult   uint64
+}{
+	{"KIB", 1 << 10}, {"MIB", 1 << 20}, {"GIB", 1 << 30}, {"TIB", 1 << 40},
+	{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"TB", 1 << 40},
+	{"K", 1 << 10}, {"M", 1 << 20}, {"G", 1 << 30}, {"T", 1 << 40},
+	{"B", 1},
+}
+
+// splitByteSize splits an uppercase size into its number and unit letter (K, M, G, T, or empty for bytes).
+func splitByteSize(s string) (num, unit string, mult uint64) {
+	for _, u := range byteUnits {
+		if rest, ok := strings.CutSuffix(s, u.suffix); ok {
+			if u.mult > 1 {
+				unit = u.suffix[:1]
+			}
+			return strings.TrimSpace(rest), unit, u.mult
+		}
+	}
+	return s, "", 1
+}
+
+// byteSizeError returns an invalid size error.
+func byteSizeError(input, reason string) error {
+	return &sharederrors.ValidationError{
+		Field:  "size",
+		Value:  input,
+		Reason: reason,
+		Err:    sharederrors.ErrInvalidSize,
+	}
 }
@@ -1,13 +1,16 @@
 package sharedvalidation
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/TubarrApp/gocommon/sharedconsts"
+	"github.com/TubarrApp/gocommon/sharederrors"
 	"github.com/TubarrApp/gocommon/sharedtemplates"
 )
 
@@ -374,7 +377,11 @@ func TestValidateMinFreeMem(t *testing.T) {
 		{"500M", "500M", true},
 		{"200K", "200K", true},
 		{"2000", "2000", true},
+		{"2GB", "2G", true},
+		{"2GiB", "2G", true},
 		{"x1", "", false},
+		{"2I", "", false},
+		{"2T", "", false},
 	}
 
 	for _, tt := range tests {
@@ -391,6 +398,42 @@ func TestValidateMinFreeMem(t *testing.T) {
 	}
 }
 
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		in     string
+		expect uint64
+		ok     bool
+	}{
+		{"2000", 2000, true},
+		{"2K", 2048, true},
+		{"2kb", 2048, true},
+		{"1.5M", 3 << 19, true},
+		{"2GiB", 2 << 30, true},
+		{" 1 T ", 1 << 40, true},
+		{"3B", 3, true},
+		{"0.5K", 512, true},
+		{"", 0, false},
+		{"2I", 0, false},
+		{"2IB", 0, false},
+		{"1.5", 0, false},
+		{"0.3K", 0, false},
+		{"20000000T", 0, false},
+		{"GB", 0, false},
+		{"-1K", 0, false},
+		{"2XB", 0, false},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseByteSize(tt.in)
+		if tt.ok && (err != nil || got != tt.expect) {
+			t.Errorf("ParseByteSize(%q) = %d, %v, expected %d", tt.in, got, err, tt.expect)
+		}
+		if !tt.ok && !errors.Is(err, sharederrors.ErrInvalidSize) {
+			t.Errorf("ParseByteSize(%q) expected ErrInvalidSize, got %v", tt.in, err)
+		}
+	}
+}
+
 func TestValidateMaxCPU(t *testing.T) {
 	// Zero values.
 	if ValidateMaxCPU(0.0, false) != 101.0 {
@@ -411,3 +454,46 @@ func TestValidateMaxCPU(t *testing.T) {
 		t.Errorf("expected clamp to 5")
 	}
 }
+
+// Errors ------------------------------------------------------------------------------------
+
+func TestValidationErrorKinds(t *testing.T) {
+	tmpFile := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(tmpFile, nil, sharedconsts.PermsPrivateFile); err != nil {
+		t.Fatalf("write temp file: %v", err)
+	}
+
+	_, videoErr := ValidateVideoCodec("bogus")
+	_, accelErr := ValidateGPUAccelType("bogus")
+	_, _, templateErr := ValidateDirectory("{{BOGUS}}", false, sharedtemplates.AllTemplatesMap)
+	_, _, notDirErr := ValidateDirectory(tmpFile, false, sharedtemplates.AllTemplatesMap)
+	_, _, missingErr := ValidateFile(filepath.Join(t.TempDir(), "missing"), false, sharedtemplates.AllTemplatesMap)
+	_, memErr := ValidateMinFreeMem("x1")
+
+	tests := []struct {
+		err      error
+		sentinel error
+		userErr  bool
+	}{
+		{videoErr, sharederrors.ErrInvalidCodec, true},
+		{accelErr, sharederrors.ErrInvalidAccelType, true},
+		{templateErr, sharederrors.ErrUnsupportedTemplateTag, true},
+		{notDirErr, sharederrors.ErrNotADirectory, true},
+		{missingErr, sharederrors.ErrPathNotFound, true},
+		{memErr, sharederrors.ErrInvalidMemorySize, true},
+	}
+
+	for _, tt := range tests {
+		if !errors.Is(tt.err, tt.sentinel) {
+			t.Errorf("expected %v to match %v", tt.err, tt.sentinel)
+		}
+		if sharederrors.IsUserError(tt.err) != tt.userErr {
+			t.Errorf("expected user error %v for %v", tt.userErr, tt.err)
+		}
+	}
+
+	// No ANSI codes in error text.
+	if strings.Contains(accelErr.Error(), "\033[") {
+		t.Errorf("error text contains ANSI codes: %q", accelErr.Error())
+	}
+}